@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/repository/sqlstore"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
+)
+
+func admin(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		createAdmin(args[1:])
+	case "reset-password":
+		resetPassword(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown admin command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func user(args []string) {
+	if len(args) == 0 || args[0] != "set-role" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	setRole(args[1:])
+}
+
+func createAdmin(args []string) {
+	flags := flag.NewFlagSet("admin create", flag.ExitOnError)
+	name := flags.String("name", "", "full name of the admin")
+	email := flags.String("email", "", "email address the admin logs in with")
+	flags.Parse(args)
+
+	if strings.TrimSpace(*name) == "" || !validEmail(*email) {
+		log.Fatal("Usage: fleet admin create -name <full name> -email <email>")
+	}
+
+	connect()
+	hash := readNewPassword(*name, *email)
+
+	userID, err := service.CreateAdmin(context.Background(), service.NewUser{
+		Name:         strings.TrimSpace(*name),
+		Email:        *email,
+		PasswordHash: hash,
+	})
+	if errors.Is(err, service.ErrEmailTaken) {
+		log.Fatalf("A user with email %s already exists", *email)
+	}
+	if err != nil {
+		log.Fatalf("Failed to create admin: %v", err)
+	}
+
+	fmt.Printf("Created super_admin %s with ID %d. They enroll in MFA on their first login.\n", *email, userID)
+}
+
+func resetPassword(args []string) {
+	flags := flag.NewFlagSet("admin reset-password", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the user")
+	flags.Parse(args)
+
+	if *email == "" {
+		log.Fatal("Usage: fleet admin reset-password -email <email>")
+	}
+
+	connect()
+	userID := findUser(*email)
+	hash := readNewPassword("", *email)
+
+	if err := service.SetPassword(context.Background(), userID, hash); err != nil {
+		log.Fatalf("Failed to reset password: %v", err)
+	}
+
+	// Whoever knew the old password must not stay logged in
+	if err := auth.RevokeUserSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions of user %d after password reset: %v", userID, err)
+	}
+	if err := auth.Revocations.RevokeUser(userID); err != nil {
+		log.Printf("Failed to revoke tokens of user %d after password reset: %v", userID, err)
+	}
+
+	fmt.Printf("Password of %s reset. Their sessions have been ended.\n", *email)
+}
+
+func setRole(args []string) {
+	flags := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the user")
+	role := flags.String("role", "", "name of the new role")
+	flags.Parse(args)
+
+	if *email == "" || *role == "" {
+		log.Fatal("Usage: fleet user set-role -email <email> -role <role>")
+	}
+
+	connect()
+	userID := findUser(*email)
+
+	err := service.SetUserRole(context.Background(), userID, *role)
+	if errors.Is(err, service.ErrSameRole) {
+		fmt.Printf("%s already has the role %s.\n", *email, *role)
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to set role: %v", err)
+	}
+
+	// The role is part of the access token, so make the user pick up the new
+	// one through /token/refresh.
+	if err := auth.Revocations.RevokeUser(userID); err != nil {
+		log.Printf("Failed to revoke tokens of user %d after role change: %v", userID, err)
+	}
+
+	fmt.Printf("%s now has the role %s.\n", *email, *role)
+}
+
+// bootstrapAdmin creates the first super_admin from BOOTSTRAP_ADMIN_NAME,
+// BOOTSTRAP_ADMIN_EMAIL and BOOTSTRAP_ADMIN_PASSWORD, so that a new
+// deployment can be administered without shell access. It does nothing once
+// there is an admin, and the variables can be removed after the first start.
+func bootstrapAdmin() {
+	email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	if email == "" {
+		return
+	}
+	name := os.Getenv("BOOTSTRAP_ADMIN_NAME")
+	plainPassword := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if strings.TrimSpace(name) == "" || !validEmail(email) {
+		log.Fatal("BOOTSTRAP_ADMIN_NAME and a valid BOOTSTRAP_ADMIN_EMAIL are required to bootstrap an admin")
+	}
+	if err := password.Check(plainPassword, name, email); err != nil {
+		log.Fatalf("Invalid BOOTSTRAP_ADMIN_PASSWORD: %v", err)
+	}
+	hash, err := password.Hash(plainPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash BOOTSTRAP_ADMIN_PASSWORD: %v", err)
+	}
+
+	created, err := service.BootstrapAdmin(context.Background(), service.NewUser{
+		Name:         strings.TrimSpace(name),
+		Email:        email,
+		PasswordHash: hash,
+	})
+	// Another instance starting at the same time may have created the admin
+	// first
+	if errors.Is(err, service.ErrEmailTaken) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to bootstrap admin: %v", err)
+	}
+	if created {
+		log.Printf("Created super_admin %s. Remove the BOOTSTRAP_ADMIN_* variables now.", email)
+	}
+}
+
+// connect opens the database for a command that changes users, which needs
+// the schema the code expects and the configured password hashing.
+func connect() {
+	if err := db.ConnectDB(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	requireMigrated()
+	configurePasswordHashing()
+}
+
+func findUser(email string) int {
+	credentials, err := sqlstore.New().Users.Credentials(context.Background(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Fatalf("No user with email %s", email)
+	}
+	if err != nil {
+		log.Fatalf("Failed to find user: %v", err)
+	}
+	return credentials.UserID
+}
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// readNewPassword reads a password that meets the policy and returns its
+// hash. On a terminal it prompts for it twice without echoing; otherwise it
+// reads the first line of stdin, e.g. from a secrets manager.
+func readNewPassword(name, email string) string {
+	var plainPassword string
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		plainPassword = prompt(fd, "Password: ")
+		if prompt(fd, "Repeat password: ") != plainPassword {
+			log.Fatal("Passwords don't match")
+		}
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatalf("Failed to read password: %v", err)
+		}
+		plainPassword = strings.TrimRight(line, "\r\n")
+	}
+
+	if err := password.Check(plainPassword, name, email); err != nil {
+		log.Fatalf("Invalid password: %v", err)
+	}
+	hash, err := password.Hash(plainPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	return hash
+}
+
+func prompt(fd int, label string) string {
+	fmt.Fprint(os.Stderr, label)
+	input, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	return string(input)
+}
@@ -0,0 +1,68 @@
+// @title Fleet Management System API
+// @version 1.0
+// @description This is a sample fleet management backend service.
+// @host localhost:8080
+// @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: fleet <command> [arguments]
+
+Commands:
+  serve [-migrate=false]     start the API server (the default)
+  migrate up                 apply every pending migration
+  migrate down               roll back the latest migration
+  migrate redo               roll back the latest migration and apply it again
+  migrate to <version>       migrate up or down to version
+  migrate status             list the migrations and when they were applied
+  migrate create <name>      add a migration to migrations/ and migrations/sqlite/
+  admin create -name <name> -email <email>
+                             create a super_admin
+  admin reset-password -email <email>
+                             set a user's password and end their sessions
+  user set-role -email <email> -role <role>
+                             move a user to another role
+
+Passwords are prompted for on a terminal and otherwise read from the first
+line of stdin. On startup, serve creates a super_admin from
+BOOTSTRAP_ADMIN_NAME, BOOTSTRAP_ADMIN_EMAIL and BOOTSTRAP_ADMIN_PASSWORD
+unless there already is one.
+`
+
+func main() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Warning: Could not load .env file. Assuming environment variables are set in the environment.")
+	}
+
+	command, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "migrate":
+		migrate(args)
+	case "admin":
+		admin(args)
+	case "user":
+		user(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
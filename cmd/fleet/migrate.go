@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/migrations"
+)
+
+// migrationDirs are where `migrate create` adds a migration, relative to the
+// repository root. Every migration exists for both databases.
+var migrationDirs = []string{"migrations", "migrations/sqlite"}
+
+func migrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			log.Fatal("Usage: fleet migrate create <name>")
+		}
+		createMigration(args[1])
+		return
+	}
+
+	if err := db.ConnectDB(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	provider, err := migrations.NewProvider(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		results, err := provider.Up(ctx)
+		printResults(results, err)
+	case "down":
+		result, err := provider.Down(ctx)
+		printResults([]*goose.MigrationResult{result}, err)
+	case "redo":
+		result, err := provider.Down(ctx)
+		printResults([]*goose.MigrationResult{result}, err)
+		result, err = provider.UpByOne(ctx)
+		printResults([]*goose.MigrationResult{result}, err)
+	case "to":
+		if len(args) != 2 {
+			log.Fatal("Usage: fleet migrate to <version>")
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid version %q", args[1])
+		}
+		current, err := provider.GetDBVersion(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read the migration version: %v", err)
+		}
+		var results []*goose.MigrationResult
+		if version >= current {
+			results, err = provider.UpTo(ctx, version)
+		} else {
+			results, err = provider.DownTo(ctx, version)
+		}
+		printResults(results, err)
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read the migration status: %v", err)
+		}
+		fmt.Printf("%-24s  %s\n", "Applied At", "Migration")
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format(time.ANSIC)
+			}
+			fmt.Printf("%-24s  %s\n", appliedAt, path.Base(status.Source.Path))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func printResults(results []*goose.MigrationResult, err error) {
+	for _, result := range results {
+		if result != nil {
+			fmt.Println(result)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// createMigration adds an empty, numbered migration to both migration
+// directories.
+func createMigration(name string) {
+	goose.SetSequential(true)
+	for _, dir := range migrationDirs {
+		if err := goose.Create(nil, dir, name, "sql"); err != nil {
+			log.Fatalf("Failed to create migration in %s: %v", dir, err)
+		}
+	}
+}
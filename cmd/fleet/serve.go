@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/cors"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/handlers"
+	"github.com/kwagmire/fleet-management-api/internal/app/repository/sqlstore"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/mail"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
+	"github.com/kwagmire/fleet-management-api/migrations"
+	//_ "github.com/kwagmire/fleet-management-api/docs"
+)
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	migrate := flags.Bool("migrate", true, "apply pending migrations on startup. When false, refuse to start while any are pending")
+	flags.Parse(args)
+
+	if err := db.ConnectDB(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	if *migrate {
+		if err := migrations.Up(context.Background(), db.DB); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Database migrations applied successfully.")
+	} else {
+		requireMigrated()
+	}
+
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		keys, err := auth.LoadKeySet(keysDir, auth.AccessTokenTTL)
+		if err != nil {
+			log.Fatalf("Failed to load JWT signing keys: %v", err)
+		}
+		auth.Keys = keys
+		go keys.ReloadEvery(5 * time.Minute)
+	}
+
+	sender, err := mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mail sender: %v", err)
+	}
+	mail.Default = sender
+
+	configurePasswordHashing()
+	bootstrapAdmin()
+	go auth.Revocations.PruneEvery(time.Hour)
+
+	// A SQLite database is served by a single instance, which drops its own
+	// cached permissions when it changes them
+	if db.Current == db.Postgres {
+		if err := auth.Permissions.Listen(os.Getenv("DB_CONNECTION_STRING")); err != nil {
+			log.Printf("Warning: %v. Role permission changes will apply after the cache expires.", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	/*mux.HandleFunc("/swagger/", httpSwagger.Handler(
+		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), //The url pointing to API definition
+	))*/
+
+	handlers.NewServer(sqlstore.New()).Routes(mux)
+
+	//mux.HandleFunc("PUT /todos/", auth.AuthMiddleware(handlers.UpdateTodo))
+	//mux.HandleFunc("DELETE /todos/", auth.AuthMiddleware(handlers.DeleteTodo))
+
+	c := cors.New(cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+	})
+
+	handler := c.Handler(mux)
+	serverPort := ":8080"
+
+	fmt.Printf("Fleet Management API server starting on http://localhost%s...", serverPort)
+	log.Fatal(http.ListenAndServe(serverPort, handler))
+}
+
+// requireMigrated stops the server when the database is behind the embedded
+// migrations, so that schema changes are applied on purpose with
+// `fleet migrate up`.
+func requireMigrated() {
+	provider, err := migrations.NewProvider(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	current, target, err := provider.GetVersions(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to read the migration version: %v", err)
+	}
+	if current < target {
+		log.Fatalf("Database is at migration %d of %d. Run `fleet migrate up` before starting the server", current, target)
+	}
+}
+
+func configurePasswordHashing() {
+	hasher, err := password.Argon2idFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure password hashing: %v", err)
+	}
+	password.Default = hasher
+}
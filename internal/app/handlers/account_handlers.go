@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+)
+
+// @Summary Delete my account
+// @Description Anonymizes the account, removes the driver or owner profile and credentials and ends every session. Owners must remove their vehicles first
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   confirm  body  models.DeleteAccountRequest  true  "Current password"
+// @Success 200 {object} map[string]string
+// @Failure 403 {string} string "Current password is incorrect"
+// @Failure 409 {string} string "Vehicles still registered"
+// @Failure 429 {string} string "Too many failed password attempts"
+// @Router /me [delete]
+func (s *Server) DeleteMyAccount(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.DeleteAccountRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if thisRequest.CurrentPassword == "" {
+		respondWithError(w, "Current password is required to delete the account", http.StatusBadRequest)
+		return
+	}
+
+	// Deleting yourself is what driver:delete.driver and owner:delete.owner
+	// grant; other roles have to ask an administrator
+	switch userDetails.Role {
+	case "driver":
+		if !s.authorize(w, r, policy.DeleteDriver, policy.Driver(userDetails.UserID)) {
+			return
+		}
+	case "vehicle_owner":
+		if !s.authorize(w, r, policy.DeleteOwner, policy.Owner(userDetails.UserID)) {
+			return
+		}
+	default:
+		respondWithError(w, "Accounts with this role can only be deleted by an administrator", http.StatusForbidden)
+		return
+	}
+
+	user, err := s.Users.Get(r.Context(), userDetails.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to delete account")
+		return
+	}
+	if !s.reauthenticate(w, r, user.ID, user.Email, user.PasswordHash, thisRequest.CurrentPassword) {
+		return
+	}
+
+	if err := s.Users.Delete(r.Context(), user.ID, user.PasswordHash); err != nil {
+		respondWithServiceError(w, err, "Failed to delete account")
+		return
+	}
+
+	log.Printf("User %d deleted their account", userDetails.UserID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Account deleted"})
+}
+
+// @Summary Export my data
+// @Description Streams a JSON archive of everything stored about the current user
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /me/export [get]
+func (s *Server) ExportMyData(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := s.Users.Profile(r.Context(), userDetails.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to export data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="fleet-export-%d.json"`, userDetails.UserID))
+	w.WriteHeader(http.StatusOK)
+
+	// Past this point the status is sent, so a failure can only cut the
+	// archive short, which leaves it as invalid JSON
+	export := newJSONStream(w)
+	err = export.field("exported_at", time.Now().UTC())
+	if err == nil {
+		err = export.field("profile", profile)
+	}
+	if err == nil {
+		err = s.Users.Export(r.Context(), userDetails.UserID, export)
+	}
+	if err == nil {
+		err = export.close()
+	}
+	if err != nil {
+		log.Printf("Failed to export data of user %d: %v", userDetails.UserID, err)
+	}
+}
+
+// jsonStream writes one JSON object field by field, flushing as it goes, so
+// large tables never have to be held in memory.
+type jsonStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	started bool
+	records int
+}
+
+func newJSONStream(w http.ResponseWriter) *jsonStream {
+	flusher, _ := w.(http.Flusher)
+	return &jsonStream{w: w, flusher: flusher}
+}
+
+func (s *jsonStream) key(name string) error {
+	prefix := ","
+	if !s.started {
+		prefix = "{"
+		s.started = true
+	}
+	encodedName, _ := json.Marshal(name)
+	_, err := fmt.Fprintf(s.w, "%s%s:", prefix, encodedName)
+	return err
+}
+
+func (s *jsonStream) field(name string, value interface{}) error {
+	if err := s.key(name); err != nil {
+		return err
+	}
+	return json.NewEncoder(s.w).Encode(value)
+}
+
+// Section, Record and EndSection make a jsonStream a
+// repository.ExportWriter, each section being an array of records.
+
+func (s *jsonStream) Section(name string) error {
+	if err := s.key(name); err != nil {
+		return err
+	}
+	s.records = 0
+	_, err := io.WriteString(s.w, "[")
+	return err
+}
+
+func (s *jsonStream) Record(record map[string]interface{}) error {
+	if s.records > 0 {
+		if _, err := io.WriteString(s.w, ","); err != nil {
+			return err
+		}
+	}
+	s.records++
+	return json.NewEncoder(s.w).Encode(record)
+}
+
+func (s *jsonStream) EndSection() error {
+	if _, err := io.WriteString(s.w, "]"); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *jsonStream) close() error {
+	if !s.started {
+		_, err := io.WriteString(s.w, "{}")
+		return err
+	}
+	_, err := io.WriteString(s.w, "}\n")
+	return err
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// @Summary Register an OAuth client
+// @Description Creates a client_credentials client acting as the given user, limited to scopes both that user's role and the caller hold. The secret is only shown in this response
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   client  body  models.CreateOAuthClientRequest  true  "Name, acting user and scopes"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {string} string "Scope not granted to the user's role"
+// @Failure 403 {string} string "Scope not granted to your role"
+// @Failure 403 {string} string "Clients can't act as admins or users with permissions you lack"
+// @Failure 404 {string} string "User not found"
+// @Router /oauth/clients [post]
+func (s *Server) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.CreateOAuthClientRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	thisRequest.Name = strings.TrimSpace(thisRequest.Name)
+	if thisRequest.Name == "" || thisRequest.UserID == 0 || len(thisRequest.Scopes) == 0 {
+		respondWithError(w, "All fields are required", http.StatusBadRequest)
+		return
+	}
+	if len(thisRequest.Name) > 100 {
+		respondWithError(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	// Nobody hands out more than they hold
+	for _, scope := range thisRequest.Scopes {
+		has, err := s.Auth.HasPermission(adminDetails, scope)
+		if err != nil {
+			respondWithError(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !has {
+			respondWithError(w, "Scope not granted to your role: "+scope, http.StatusForbidden)
+			return
+		}
+	}
+
+	user, err := s.Users.Get(r.Context(), thisRequest.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to load user")
+		return
+	}
+	role := user.Role
+
+	// A client acting as a user is as good as impersonating them
+	allowedTarget, err := s.canImpersonate(adminDetails.Role, role)
+	if err != nil {
+		respondWithError(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowedTarget {
+		respondWithError(w, "Clients can't act as admins or users with permissions you lack", http.StatusForbidden)
+		return
+	}
+
+	granted, err := s.Permissions.RolePermissions(role)
+	if err != nil {
+		respondWithError(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	allowed := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		allowed[permission] = true
+	}
+	for _, scope := range thisRequest.Scopes {
+		if !allowed[scope] {
+			respondWithError(w, "Scope not granted to the user's role: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	id, clientID, secret, err := s.OAuthClients.Create(thisRequest.Name, thisRequest.UserID, thisRequest.Scopes)
+	if err != nil {
+		respondWithError(w, "Failed to create OAuth client: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d registered OAuth client %s acting as user %d", adminDetails.UserID, clientID, thisRequest.UserID)
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":       "OAuth client created. Store the secret now, it won't be shown again",
+		"id":            id,
+		"client_id":     clientID,
+		"client_secret": secret,
+	})
+}
+
+func (s *Server) GetAllOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := s.OAuthClients.List()
+	if err != nil {
+		respondWithError(w, "Failed to retrieve OAuth clients: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+func (s *Server) RevokeOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid client ID", http.StatusBadRequest)
+		return
+	}
+
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := s.OAuthClients.Revoke(id)
+	if err != nil {
+		respondWithError(w, "Failed to revoke OAuth client: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		respondWithError(w, "OAuth client not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Admin %d revoked OAuth client %d", adminDetails.UserID, id)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "OAuth client revoked"})
+}
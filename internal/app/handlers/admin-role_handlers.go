@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+var (
+	roleNamePattern       = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+	permissionNamePattern = regexp.MustCompile(`^[a-z_]+:[a-z_]+\.[a-z_]+$`)
+)
+
+func (s *Server) GetAllRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.Roles.List(r.Context())
+	if err != nil {
+		respondWithError(w, "Failed to retrieve roles: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"data": roles, "total": len(roles)})
+}
+
+func (s *Server) CreateRole(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.CreateRoleRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !roleNamePattern.MatchString(thisRequest.Name) {
+		respondWithError(w, "Role name must be 2-50 lowercase letters, digits or underscores", http.StatusBadRequest)
+		return
+	}
+
+	thisRole := models.Role{
+		Name:             thisRequest.Name,
+		SelfRegistration: thisRequest.SelfRegistration,
+		Permissions:      []string{},
+	}
+	thisRole.ID, err = s.Roles.Create(r.Context(), thisRole.Name, thisRole.SelfRegistration)
+	if errors.Is(err, repository.ErrExists) {
+		respondWithError(w, "Role already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Failed to create role: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"message": "Role created successfully", "data": thisRole})
+}
+
+func (s *Server) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Roles.Delete(r.Context(), roleID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		respondWithError(w, "Role not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrSystem):
+		respondWithError(w, "System roles can't be deleted", http.StatusForbidden)
+		return
+	case errors.Is(err, repository.ErrInUse):
+		respondWithError(w, "Role is still assigned to users", http.StatusConflict)
+		return
+	case err != nil:
+		respondWithError(w, "Failed to delete role: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Role deleted successfully"})
+}
+
+func (s *Server) GetAllPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := s.Roles.Permissions(r.Context())
+	if err != nil {
+		respondWithError(w, "Failed to retrieve permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"data": permissions, "total": len(permissions)})
+}
+
+func (s *Server) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.CreatePermissionRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !permissionNamePattern.MatchString(thisRequest.Name) {
+		respondWithError(w, "Permission name must look like 'scope:action.resource'", http.StatusBadRequest)
+		return
+	}
+
+	thisPermission := models.Permission{Name: thisRequest.Name}
+	thisPermission.ID, err = s.Roles.CreatePermission(r.Context(), thisPermission.Name)
+	if errors.Is(err, repository.ErrExists) {
+		respondWithError(w, "Permission already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Failed to create permission: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"message": "Permission created successfully", "data": thisPermission})
+}
+
+func (s *Server) DeletePermission(w http.ResponseWriter, r *http.Request) {
+	permissionID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid permission ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Roles.DeletePermission(r.Context(), permissionID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		respondWithError(w, "Permission not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrSystem):
+		respondWithError(w, "System permissions can't be deleted", http.StatusForbidden)
+		return
+	case err != nil:
+		respondWithError(w, "Failed to delete permission: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Permission deleted successfully"})
+}
+
+func (s *Server) GrantPermission(w http.ResponseWriter, r *http.Request) {
+	roleName, permissionName, ok := s.lookupRolePermission(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Roles.Grant(r.Context(), roleName, permissionName); err != nil {
+		respondWithError(w, "Failed to grant permission: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Permission granted to role"})
+}
+
+func (s *Server) RevokePermission(w http.ResponseWriter, r *http.Request) {
+	roleName, permissionName, ok := s.lookupRolePermission(w, r)
+	if !ok {
+		return
+	}
+
+	if roleName == "super_admin" && permissionName == "admin:manage.roles" {
+		respondWithError(w, "Revoking this permission would lock every admin out of role management", http.StatusForbidden)
+		return
+	}
+
+	if err := s.Roles.Revoke(r.Context(), roleName, permissionName); err != nil {
+		respondWithError(w, "Failed to revoke permission: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Permission revoked from role"})
+}
+
+// lookupRolePermission resolves the {id} and {permission_id} path values and
+// writes the error response itself when either doesn't exist.
+func (s *Server) lookupRolePermission(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	roleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid role ID", http.StatusBadRequest)
+		return "", "", false
+	}
+	permissionID, err := parsePathID(r, "permission_id")
+	if err != nil {
+		respondWithError(w, "Invalid permission ID", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	roleName, err := s.Roles.Name(r.Context(), roleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondWithError(w, "Role not found", http.StatusNotFound)
+		return "", "", false
+	}
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	permissionName, err := s.Roles.PermissionName(r.Context(), permissionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondWithError(w, "Permission not found", http.StatusNotFound)
+		return "", "", false
+	}
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+
+	return roleName, permissionName, true
+}
+
+func (s *Server) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.SetRoleRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.Role == "" {
+		respondWithError(w, "Role is required", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Users.SetRole(r.Context(), userID, thisRequest.Role)
+	switch {
+	case errors.Is(err, service.ErrSameRole):
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "User already has this role"})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		respondWithError(w, "User not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrRoleNotFound):
+		respondWithError(w, "Role doesn't exist", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrProfileRole):
+		respondWithError(w, "Users can't be moved in or out of the driver and vehicle_owner roles", http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrLastAdmin):
+		respondWithError(w, "The last super_admin can't be given another role", http.StatusConflict)
+		return
+	case err != nil:
+		respondWithError(w, "Failed to update role: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The role is part of the access token, so make the user pick up the new
+	// one through /token/refresh.
+	if err := s.Logins.RevokeUser(userID); err != nil {
+		log.Printf("Failed to revoke tokens of user %d after role change: %v", userID, err)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "User role updated successfully"})
+}
+
+func (s *Server) SetRoleMFA(w http.ResponseWriter, r *http.Request) {
+	roleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.RoleMFARequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Roles.SetMFARequired(r.Context(), roleID, thisRequest.Required)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondWithError(w, "Role not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Failed to update role: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Role MFA requirement updated"})
+}
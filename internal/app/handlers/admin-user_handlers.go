@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+func (s *Server) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := s.Users.Get(r.Context(), userID); err != nil {
+		respondWithServiceError(w, err, "Failed to revoke tokens")
+		return
+	}
+
+	if err := s.Logins.RevokeUser(userID); err != nil {
+		log.Printf("Failed to revoke tokens of user %d: %v", userID, err)
+		respondWithError(w, "Failed to revoke tokens", http.StatusInternalServerError)
+		return
+	}
+	if err := s.Logins.RevokeUserSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+		respondWithError(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	if err := s.APIKeys.RevokeAll(userID); err != nil {
+		log.Printf("Failed to revoke API keys of user %d: %v", userID, err)
+		respondWithError(w, "Failed to revoke API keys", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d revoked all tokens of user %d", adminDetails.UserID, userID)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "All tokens of the user have been revoked"})
+}
+
+func (s *Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to unlock user")
+		return
+	}
+
+	if err := s.Logins.ResetFailures(auth.AccountKey(user.Email)); err != nil {
+		respondWithError(w, "Failed to unlock user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.Logins.ResetFailures(auth.MFAKey(userID)); err != nil {
+		respondWithError(w, "Failed to unlock user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.Logins.RecordEvent(auth.Event{
+		UserID:  userID,
+		Type:    auth.EventAccountUnlocked,
+		Email:   user.Email,
+		IP:      auth.ClientIP(r),
+		Details: "unlocked by admin " + strconv.Itoa(adminDetails.UserID),
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "User account unlocked"})
+}
+
+// @Summary Impersonate a user
+// @Description Issues a short-lived token acting as the user, so support can see what they see. Every request made with it is logged against both the admin and the user
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   id      path  int                        true   "User ID"
+// @Param   reason  body  models.ImpersonateRequest  false  "Why the user is being impersonated"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {string} string "Admins and users with permissions you lack cannot be impersonated"
+// @Router /users/{id}/impersonate [post]
+func (s *Server) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	var thisRequest models.ImpersonateRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &thisRequest); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to impersonate user")
+		return
+	}
+	allowed, err := s.canImpersonate(adminDetails.Role, user.Role)
+	if err != nil {
+		respondWithError(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		respondWithError(w, "Admins and users with permissions you lack cannot be impersonated", http.StatusForbidden)
+		return
+	}
+
+	token, err := auth.GenerateImpersonationToken(userID, user.Role, adminDetails.UserID)
+	if err != nil {
+		respondWithError(w, "Failed to generate token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details := "impersonated by admin " + strconv.Itoa(adminDetails.UserID)
+	if reason := strings.TrimSpace(thisRequest.Reason); reason != "" {
+		details += ": " + reason
+	}
+	s.Logins.RecordEvent(auth.Event{
+		UserID:  userID,
+		Type:    auth.EventImpersonation,
+		Email:   user.Email,
+		IP:      auth.ClientIP(r),
+		Details: details,
+	})
+	log.Printf("Admin %d started impersonating user %d", adminDetails.UserID, userID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":    "Impersonation token issued",
+		"token":      token,
+		"expires_in": int(auth.ImpersonationTTL.Seconds()),
+	})
+}
+
+// canImpersonate reports whether an admin with actorRole may act as a user
+// with targetRole. Admin roles are never impersonated, and neither are roles
+// holding a permission the admin doesn't have, so impersonation can't be used
+// to gain permissions.
+func (s *Server) canImpersonate(actorRole, targetRole string) (bool, error) {
+	permissions, err := s.Permissions.RolePermissions(targetRole)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range permissions {
+		if auth.IsAdminPermission(permission) {
+			return false, nil
+		}
+		has, err := s.Permissions.HasPermission(actorRole, permission)
+		if err != nil {
+			return false, err
+		}
+		if !has {
+			return false, nil
+		}
+	}
+	return true, nil
+}
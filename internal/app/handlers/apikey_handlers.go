@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// @Summary Create an API key
+// @Description Creates a long-lived key acting as the current user, limited to the given permissions. The key is only shown in this response
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   key  body  models.CreateAPIKeyRequest  true  "Name, scopes and optional lifetime"
+// @Success 201 {object} map[string]interface{}
+// @Failure 403 {string} string "Scope not granted to your role"
+// @Router /api_keys [post]
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.CreateAPIKeyRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	thisRequest.Name = strings.TrimSpace(thisRequest.Name)
+	if thisRequest.Name == "" || len(thisRequest.Scopes) == 0 {
+		respondWithError(w, "Name and at least one scope are required", http.StatusBadRequest)
+		return
+	}
+	if len(thisRequest.Name) > 100 {
+		respondWithError(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if thisRequest.ExpiresInDays < 0 {
+		respondWithError(w, "expires_in_days cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	// A key can never do more than its owner
+	granted, err := s.Permissions.RolePermissions(userDetails.Role)
+	if err != nil {
+		respondWithError(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	allowed := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		allowed[permission] = true
+	}
+	for _, scope := range thisRequest.Scopes {
+		if !allowed[scope] {
+			respondWithError(w, "Scope not granted to your role: "+scope, http.StatusForbidden)
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if thisRequest.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, thisRequest.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	keyID, prefix, key, err := s.APIKeys.Create(userDetails.UserID, thisRequest.Name, thisRequest.Scopes, expiresAt)
+	if err != nil {
+		respondWithError(w, "Failed to create API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d created API key %d (%s)", userDetails.UserID, keyID, prefix)
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":    "API key created. Store it now, it won't be shown again",
+		"id":         keyID,
+		"prefix":     prefix,
+		"key":        key,
+		"expires_at": expiresAt,
+	})
+}
+
+// @Summary List API keys
+// @Description Lists the current user's API keys, including revoked and expired ones
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Router /api_keys [get]
+func (s *Server) GetMyAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := s.APIKeys.List(userDetails.UserID)
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// @Summary Revoke an API key
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  int  true  "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {string} string "API key not found"
+// @Router /api_keys/{id} [delete]
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := s.APIKeys.Revoke(userDetails.UserID, keyID)
+	if err != nil {
+		respondWithError(w, "Failed to revoke API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		respondWithError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+)
+
+// @Summary Unassign a vehicle's driver
+// @Description Ends the current assignment. A vehicle in use becomes available
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  int  true  "Vehicle ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {string} string "Vehicle not found"
+// @Failure 409 {string} string "Vehicle has no driver"
+// @Router /vehicles/{id}/unassign_driver [put]
+func (s *Server) UnassignDriver(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.authorize(w, r, policy.AssignDriver, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	driverID, err := s.Vehicles.UnassignDriver(r.Context(), vehicleID, s.actorOf(userDetails))
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to unassign driver")
+		return
+	}
+
+	log.Printf("User %d unassigned driver %d from vehicle %d", userDetails.UserID, driverID, vehicleID)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Driver unassigned successfully"})
+}
+
+// @Summary Reassign a vehicle
+// @Description Swaps the vehicle's driver for another unassigned driver in one step. The status of the vehicle doesn't change
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   id      path  int                   true  "Vehicle ID"
+// @Param   driver  body  models.AssignRequest  true  "The new driver"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {string} string "Driver not found"
+// @Failure 409 {string} string "Driver is already assigned to a vehicle"
+// @Router /vehicles/{id}/reassign_driver [put]
+func (s *Server) ReassignDriver(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.authorize(w, r, policy.AssignDriver, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.AssignRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	newDriverID, err := strconv.Atoi(thisRequest.DriverID)
+	if err != nil {
+		respondWithError(w, "Invalid driver ID", http.StatusBadRequest)
+		return
+	}
+
+	oldDriverID, err := s.Vehicles.ReassignDriver(r.Context(), vehicleID, newDriverID, s.actorOf(userDetails))
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to reassign vehicle")
+		return
+	}
+
+	log.Printf("User %d reassigned vehicle %d from driver %d to %d", userDetails.UserID, vehicleID, oldDriverID, newDriverID)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Vehicle reassigned successfully"})
+}
+
+// @Summary Get a vehicle's assignments
+// @Description Lists who drove the vehicle and when, newest first. With at, only the assignment running at that time
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path   int     true   "Vehicle ID"
+// @Param   at  query  string  false  "RFC 3339 timestamp"
+// @Success 200 {array} models.VehicleAssignment
+// @Router /vehicles/{id}/assignments [get]
+func (s *Server) GetVehicleAssignments(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorize(w, r, policy.ReadAssignments, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	respondWithAssignments(w, r, vehicleID, s.Vehicles.Assignments)
+}
+
+// @Summary Get a driver's assignments
+// @Description Lists the vehicles the driver had and when, newest first. With at, only the assignment running at that time
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path   int     true   "Driver ID"
+// @Param   at  query  string  false  "RFC 3339 timestamp"
+// @Success 200 {array} models.VehicleAssignment
+// @Router /drivers/{id}/assignments [get]
+func (s *Server) GetDriverAssignments(w http.ResponseWriter, r *http.Request) {
+	driverID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid driver ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorize(w, r, policy.ReadDriver, policy.Driver(driverID)) {
+		return
+	}
+
+	respondWithAssignments(w, r, driverID, s.Drivers.Assignments)
+}
+
+// respondWithAssignments lists the assignments list returns for id, those
+// running at the time in the at query parameter if there is one.
+func respondWithAssignments(
+	w http.ResponseWriter,
+	r *http.Request,
+	id int,
+	list func(ctx context.Context, id int, at time.Time) ([]models.VehicleAssignment, error),
+) {
+	var at time.Time
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			respondWithError(w, "Invalid time, use RFC 3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	assignments, err := list(r.Context(), id, at)
+	if err != nil {
+		respondWithError(w, "Failed to retrieve assignments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, assignments)
+}
@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
 )
 
 func respondWithJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -20,3 +26,64 @@ func respondWithJSON(w http.ResponseWriter, status int, payload interface{}) {
 func respondWithError(w http.ResponseWriter, message string, status int) {
 	respondWithJSON(w, status, map[string]string{"error": message})
 }
+
+func parsePathID(r *http.Request, name string) (int, error) {
+	return strconv.Atoi(r.PathValue(name))
+}
+
+// respondWithServiceError writes the response for an error returned by the
+// service layer. Anything it doesn't know is reported as failure.
+func respondWithServiceError(w http.ResponseWriter, err error, failure string) {
+	var guardError *vehiclestatus.GuardError
+	switch {
+	case errors.Is(err, service.ErrOwnerNotFound):
+		respondWithError(w, "Vehicle owner not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrVehicleNotFound):
+		respondWithError(w, "Vehicle not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrDriverNotFound):
+		respondWithError(w, "Driver not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrUserNotFound):
+		respondWithError(w, "User not found", http.StatusNotFound)
+
+	case errors.Is(err, service.ErrRoleNotAllowed):
+		respondWithError(w, "User can only register as a driver or vehicle_owner", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidVehicle):
+		respondWithError(w, "Vehicle doesn't meet system requirements", http.StatusBadRequest)
+	case errors.Is(err, service.ErrValueTooLong):
+		respondWithError(w, "A field is too long", http.StatusBadRequest)
+	case errors.Is(err, vehiclestatus.ErrUnknownStatus):
+		respondWithError(w, "Unknown vehicle status", http.StatusBadRequest)
+
+	case errors.Is(err, vehiclestatus.ErrForbidden):
+		respondWithError(w, "Not permitted to make this transition", http.StatusForbidden)
+
+	case errors.Is(err, service.ErrEmailTaken):
+		respondWithError(w, "Email already exists", http.StatusConflict)
+	case errors.Is(err, service.ErrLicenseTaken):
+		respondWithError(w, "License ID already registered", http.StatusConflict)
+	case errors.Is(err, service.ErrPlateTaken):
+		respondWithError(w, "License plate already registered", http.StatusConflict)
+	case errors.Is(err, service.ErrVehicleUnavailable):
+		respondWithError(w, "Vehicle is not available for assignment", http.StatusConflict)
+	case errors.Is(err, service.ErrNoDriver):
+		respondWithError(w, "Vehicle has no driver", http.StatusConflict)
+	case errors.Is(err, service.ErrDriverAssigned):
+		respondWithError(w, "Driver is already assigned to a vehicle", http.StatusConflict)
+	case errors.Is(err, service.ErrSameDriver):
+		respondWithError(w, "Driver is already assigned to this vehicle", http.StatusConflict)
+	case errors.Is(err, service.ErrSameStatus):
+		respondWithError(w, "Vehicle already has this status", http.StatusConflict)
+	case errors.Is(err, vehiclestatus.ErrInvalidTransition):
+		respondWithError(w, "Can't change the vehicle's status: "+err.Error(), http.StatusConflict)
+	case errors.As(err, &guardError):
+		respondWithError(w, "Can't change the vehicle's status: "+guardError.Reason, http.StatusConflict)
+	case errors.Is(err, service.ErrPasswordChanged):
+		respondWithError(w, "Password was changed in the meantime, try again", http.StatusConflict)
+	case errors.Is(err, service.ErrVehiclesRegistered):
+		respondWithError(w, "Delete your registered vehicles before deleting your account", http.StatusConflict)
+
+	default:
+		log.Printf("%s: %v", failure, err)
+		respondWithError(w, failure+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+)
+
+// @Summary Public signing keys
+// @Description Lists the public keys that access tokens can be verified with, as a JSON Web Key Set
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := []auth.JWK{}
+	if auth.Keys != nil {
+		keys = append(keys, auth.Keys.JWKS()...)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// @Summary Start MFA enrollment
+// @Description Generates a TOTP secret, provisioning URI and recovery codes. MFA is enabled once confirmed with a code
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 201 {object} auth.MFAEnrollment
+// @Failure 409 {string} string "MFA already enabled"
+// @Router /me/mfa [post]
+func (s *Server) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	s.startMFAEnrollment(w, r, userDetails.UserID)
+}
+
+// @Summary Confirm MFA enrollment
+// @Description Enables MFA after checking a code from the authenticator app
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   code  body  models.MFACodeRequest  true  "Current TOTP code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid authentication code"
+// @Failure 429 {string} string "Too many invalid authentication codes"
+// @Router /me/mfa/confirm [post]
+func (s *Server) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.MFACodeRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Logins.ConfirmMFAEnrollment(userDetails.UserID, thisRequest.Code); err != nil {
+		respondWithMFAError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Multi-factor authentication enabled"})
+}
+
+// @Summary Disable MFA
+// @Description Turns MFA off. Not allowed when the user's role requires it
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   code  body  models.MFACodeRequest  true  "Current TOTP or recovery code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid authentication code"
+// @Failure 403 {string} string "MFA is required for this role"
+// @Failure 429 {string} string "Too many invalid authentication codes"
+// @Router /me/mfa [delete]
+func (s *Server) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.MFACodeRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	enabled, required, err := s.Logins.MFAStatus(userDetails.UserID)
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		respondWithError(w, "Multi-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if required {
+		respondWithError(w, "Multi-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+
+	if err := s.Logins.VerifyMFACode(userDetails.UserID, thisRequest.Code); err != nil {
+		respondWithMFAError(w, err)
+		return
+	}
+
+	if err := s.Logins.DisableMFA(userDetails.UserID); err != nil {
+		respondWithError(w, "Failed to disable MFA: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Multi-factor authentication disabled"})
+}
+
+// @Summary Start MFA enrollment during login
+// @Description For users whose role requires MFA but who haven't enrolled yet. Takes the mfa_token returned by /login
+// @Accept  json
+// @Produce json
+// @Param   token  body  models.MFAEnrollRequest  true  "MFA challenge token"
+// @Success 201 {object} auth.MFAEnrollment
+// @Failure 401 {string} string "Invalid or expired MFA token"
+// @Router /login/mfa/enroll [post]
+func (s *Server) EnrollMFAOnLogin(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.MFAEnrollRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := auth.ValidateMFAChallenge(thisRequest.MFAToken)
+	if err != nil || !challenge.Enroll {
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	s.startMFAEnrollment(w, r, challenge.UserID)
+}
+
+// @Summary Complete a login with MFA
+// @Description Exchanges the mfa_token returned by /login and a TOTP or recovery code for an access token
+// @Accept  json
+// @Produce json
+// @Param   login  body  models.MFALoginRequest  true  "MFA challenge token and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid authentication code"
+// @Failure 401 {string} string "Invalid or expired MFA token"
+// @Failure 429 {string} string "Too many invalid authentication codes"
+// @Router /login/mfa [post]
+func (s *Server) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.MFALoginRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.MFAToken == "" || thisRequest.Code == "" {
+		respondWithError(w, "MFA token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := auth.ValidateMFAChallenge(thisRequest.MFAToken)
+	if err != nil {
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	// When enrollment is required by the role, the first valid code both
+	// confirms the authenticator and completes the login.
+	if err := s.Logins.CompleteMFAChallenge(challenge, thisRequest.Code); err != nil {
+		respondWithMFAError(w, err)
+		return
+	}
+
+	user, err := s.Users.Get(r.Context(), challenge.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to load user")
+		return
+	}
+
+	s.issueLoginTokens(w, r, user.ID, user.Role)
+}
+
+func respondWithMFAChallenge(w http.ResponseWriter, userID int, enroll bool) {
+	mfaToken, err := auth.GenerateMFAChallenge(userID, enroll)
+	if err != nil {
+		respondWithError(w, "Failed to generate MFA token", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Enter the code from your authenticator app at /login/mfa"
+	if enroll {
+		message = "Your role requires multi-factor authentication. Enroll at /login/mfa/enroll, then confirm at /login/mfa"
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":              message,
+		"mfa_required":         true,
+		"mfa_enrollment":       enroll,
+		"mfa_token":            mfaToken,
+		"mfa_token_expires_in": int(auth.MFAChallengeTTL.Seconds()),
+	})
+}
+
+func (s *Server) startMFAEnrollment(w http.ResponseWriter, r *http.Request, userID int) {
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to start MFA enrollment")
+		return
+	}
+
+	enrollment, err := s.Logins.StartMFAEnrollment(userID, user.Email)
+	if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+		respondWithError(w, "Multi-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to start MFA enrollment for user %d: %v", userID, err)
+		respondWithError(w, "Failed to start MFA enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Add the secret to your authenticator app and confirm with a code. Store the recovery codes somewhere safe, they are only shown once",
+		"data":    enrollment,
+	})
+}
+
+func respondWithMFAError(w http.ResponseWriter, err error) {
+	var lockedError *auth.MFALockedError
+	switch {
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		respondWithError(w, "Invalid authentication code", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrMFANotPending):
+		respondWithError(w, "Start multi-factor enrollment first", http.StatusConflict)
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		respondWithError(w, "Multi-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, auth.ErrMFAChallengeUsed):
+		respondWithError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+	case errors.As(err, &lockedError):
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedError.Until).Seconds())+1))
+		respondWithError(w, "Too many invalid authentication codes. Try again later", http.StatusTooManyRequests)
+	default:
+		respondWithError(w, "Failed to verify authentication code: "+err.Error(), http.StatusInternalServerError)
+	}
+}
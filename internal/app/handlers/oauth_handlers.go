@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+)
+
+// @Summary OAuth2 token endpoint
+// @Description Issues access tokens with the client_credentials grant (RFC 6749 section 4.4). Clients authenticate with HTTP Basic or client_id and client_secret form fields
+// @Accept  x-www-form-urlencoded
+// @Produce json
+// @Param   grant_type  formData  string  true   "Must be client_credentials"
+// @Param   scope       formData  string  false  "Space separated permission names, defaults to all the client's scopes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string "OAuth2 error response"
+// @Failure 401 {object} map[string]string "invalid_client"
+// @Router /oauth/token [post]
+func (s *Server) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, "invalid_request", "Malformed form body", http.StatusBadRequest)
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if grantType == "" {
+		respondWithOAuthError(w, "invalid_request", "grant_type is required", http.StatusBadRequest)
+		return
+	}
+	if grantType != "client_credentials" {
+		respondWithOAuthError(w, "unsupported_grant_type", "Only client_credentials is supported", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		allowed := make(map[string]bool, len(client.Scopes))
+		for _, scope := range client.Scopes {
+			allowed[scope] = true
+		}
+		for _, scope := range requested {
+			if !allowed[scope] {
+				respondWithOAuthError(w, "invalid_scope", "Scope not allowed for this client: "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+		scopes = requested
+	}
+	if len(scopes) == 0 {
+		respondWithOAuthError(w, "invalid_scope", "The client has no scopes", http.StatusBadRequest)
+		return
+	}
+
+	token, err := auth.GenerateClientToken(client, scopes)
+	if err != nil {
+		log.Printf("Failed to issue token to client %s: %v", client.ClientID, err)
+		respondWithOAuthError(w, "server_error", "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.ClientTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// @Summary OAuth2 token introspection
+// @Description Reports whether a token is active (RFC 7662). Clients can only introspect tokens issued to themselves
+// @Accept  x-www-form-urlencoded
+// @Produce json
+// @Param   token  formData  string  true  "Access token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string "invalid_client"
+// @Router /oauth/introspect [post]
+func (s *Server) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, "invalid_request", "Malformed form body", http.StatusBadRequest)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithOAuthError(w, "invalid_request", "token is required", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := s.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	inactive := map[string]interface{}{"active": false}
+
+	claims, err := auth.ValidateToken(token)
+	if err != nil || claims.ClientID != client.ClientID {
+		respondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+	revoked, err := s.Logins.IsRevoked(claims)
+	if err != nil {
+		log.Printf("Failed to check token revocation: %v", err)
+		respondWithOAuthError(w, "server_error", "Failed to verify token", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		respondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"active":     true,
+		"client_id":  claims.ClientID,
+		"scope":      claims.Scope,
+		"sub":        strconv.Itoa(claims.UserID),
+		"role":       claims.Role,
+		"token_type": "Bearer",
+		"exp":        claims.ExpiresAt.Unix(),
+		"iat":        claims.IssuedAt.Unix(),
+		"jti":        claims.ID,
+	})
+}
+
+// authenticateOAuthClient reads the client credentials from HTTP Basic or
+// from the form, and writes an invalid_client error when they don't check out.
+func (s *Server) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (*auth.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		if r.PostForm.Get("client_secret") != "" {
+			respondWithOAuthError(w, "invalid_request", "Use only one client authentication method", http.StatusBadRequest)
+			return nil, false
+		}
+		// Basic credentials are form encoded before being base64 encoded
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(clientID)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			respondWithOAuthError(w, "invalid_request", "Malformed client credentials", http.StatusBadRequest)
+			return nil, false
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" || secret == "" {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		respondWithOAuthError(w, "invalid_client", "Client authentication is required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	client, err := s.OAuthClients.Authenticate(clientID, secret)
+	if errors.Is(err, auth.ErrInvalidClient) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		respondWithOAuthError(w, "invalid_client", "Invalid client credentials", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to authenticate OAuth client: %v", err)
+		respondWithOAuthError(w, "server_error", "Failed to authenticate client", http.StatusInternalServerError)
+		return nil, false
+	}
+	return client, true
+}
+
+// respondWithOAuthError writes errors in the shape RFC 6749 section 5.2
+// requires, which OAuth client libraries rely on.
+func respondWithOAuthError(w http.ResponseWriter, code, description string, status int) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
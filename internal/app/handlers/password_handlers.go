@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/mail"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// @Summary Request a password reset
+// @Description Emails a single-use password reset link if an account with the email exists
+// @Accept  json
+// @Produce json
+// @Param   email  body  models.ForgotPasswordRequest  true  "Account email"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Router /password/forgot [post]
+func (s *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.ForgotPasswordRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.Email == "" {
+		respondWithError(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	// The response is the same whether or not the account exists so that
+	// this endpoint can't be used to find out who is registered.
+	response := map[string]string{"message": "If an account with that email exists, a password reset link has been sent"}
+
+	credentials, err := s.Users.Credentials(r.Context(), thisRequest.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		respondWithJSON(w, http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID := credentials.UserID
+	user, err := s.Users.Get(r.Context(), userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		respondWithJSON(w, http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.Users.IssuePasswordResetToken(r.Context(), userID, passwordResetTTL)
+	if err != nil {
+		log.Printf("Failed to issue password reset token for user %d: %v", userID, err)
+		respondWithError(w, "Failed to start password reset", http.StatusInternalServerError)
+		return
+	}
+
+	msg := mail.Message{
+		To:      thisRequest.Email,
+		Subject: "Reset your Fleet Management password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			user.Fullname, int(passwordResetTTL.Minutes()), linkWithToken("PASSWORD_RESET_URL", "/password/reset", token),
+		),
+	}
+	if err := mail.Default.Send(r.Context(), msg); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", userID, err)
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// @Summary Reset a password
+// @Description Sets a new password using a token from /password/forgot and signs the user out everywhere
+// @Accept  json
+// @Produce json
+// @Param   reset  body  models.ResetPasswordRequest  true  "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid or expired token"
+// @Router /password/reset [post]
+func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.ResetPasswordRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.Token == "" {
+		respondWithError(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(thisRequest.NewPassword) < password.MinLength {
+		respondWithError(w, "Invalid password: "+password.ErrTooShort.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The full policy needs the user's name and email, which are only known
+	// once the token has been checked
+	_, err = s.Users.ResetPassword(r.Context(), thisRequest.Token, func(fullname, email string) (string, error) {
+		if err := password.Check(thisRequest.NewPassword, fullname, email); err != nil {
+			return "", invalidPasswordError{err}
+		}
+		return password.Hash(thisRequest.NewPassword)
+	})
+	var invalidPassword invalidPasswordError
+	switch {
+	case errors.Is(err, auth.ErrInvalidOneTimeToken):
+		respondWithError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	case errors.As(err, &invalidPassword):
+		respondWithError(w, "Invalid password: "+invalidPassword.err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		respondWithError(w, "Failed to reset password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password reset successful. Login with your new password"})
+}
+
+// invalidPasswordError carries the reason a new password was rejected out of
+// the reset.
+type invalidPasswordError struct{ err error }
+
+func (e invalidPasswordError) Error() string { return e.err.Error() }
+
+// linkWithToken builds the link emailed to users. envVar lets the frontend
+// page that handles the token be configured; by default it points at this API.
+func linkWithToken(envVar, defaultPath, token string) string {
+	base := os.Getenv(envVar)
+	if base == "" {
+		base = "http://localhost:8080" + defaultPath
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
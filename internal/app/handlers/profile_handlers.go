@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+)
+
+// @Summary Get my profile
+// @Description Returns the current user's account and the data of their role: license and vehicle for drivers, fleet size for owners
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.Profile
+// @Router /me [get]
+func (s *Server) GetMyProfile(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := s.Users.Profile(r.Context(), userDetails.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to load profile")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, profile)
+}
+
+// @Summary Update my profile
+// @Description Changes the fields present in the body. Changing the email or password requires current_password. A new email must be verified again, a new password signs out the other sessions
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   profile  body  models.UpdateProfileRequest  true  "Fields to change"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 403 {string} string "Current password is incorrect"
+// @Failure 409 {string} string "Email already exists"
+// @Failure 429 {string} string "Too many failed password attempts"
+// @Router /me [patch]
+func (s *Server) UpdateMyProfile(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.UpdateProfileRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.Fullname == nil && thisRequest.Email == nil && thisRequest.NewPassword == nil && thisRequest.LicenseID == nil {
+		respondWithError(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	// Only drivers have a license, and changing it is what
+	// driver:update.driver grants
+	if thisRequest.LicenseID != nil {
+		if userDetails.Role != "driver" {
+			respondWithError(w, "Only drivers have a license ID", http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(w, r, policy.UpdateDriver, policy.Driver(userDetails.UserID)) {
+			return
+		}
+	}
+
+	user, err := s.Users.Get(r.Context(), userDetails.UserID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to update profile")
+		return
+	}
+
+	if thisRequest.Email != nil || thisRequest.NewPassword != nil {
+		if thisRequest.CurrentPassword == "" {
+			respondWithError(w, "Current password is required to change the email or password", http.StatusBadRequest)
+			return
+		}
+		if !s.reauthenticate(w, r, user.ID, user.Email, user.PasswordHash, thisRequest.CurrentPassword) {
+			return
+		}
+	}
+
+	var changes service.ProfileChanges
+	fullname, email := user.Fullname, user.Email
+	if thisRequest.Fullname != nil {
+		fullname = strings.TrimSpace(*thisRequest.Fullname)
+		if fullname == "" || len(fullname) > 100 {
+			respondWithError(w, "Full name must be between 1 and 100 characters", http.StatusBadRequest)
+			return
+		}
+		changes.Fullname = &fullname
+	}
+
+	if thisRequest.Email != nil && *thisRequest.Email != user.Email {
+		email = *thisRequest.Email
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			respondWithError(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		changes.Email = &email
+	}
+
+	if thisRequest.LicenseID != nil {
+		licenseID := strings.TrimSpace(*thisRequest.LicenseID)
+		if licenseID == "" || len(licenseID) > 50 {
+			respondWithError(w, "License ID must be between 1 and 50 characters", http.StatusBadRequest)
+			return
+		}
+		changes.LicenseID = &licenseID
+	}
+
+	if thisRequest.NewPassword != nil {
+		// Checked last so that a name or email changed in the same request
+		// is taken into account
+		if err := password.Check(*thisRequest.NewPassword, fullname, email); err != nil {
+			respondWithError(w, "Invalid password: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		newHash, err := password.Hash(*thisRequest.NewPassword)
+		if err != nil {
+			respondWithError(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+		changes.PasswordHash = &newHash
+	}
+
+	if err := s.Users.UpdateProfile(r.Context(), user.ID, user.PasswordHash, changes); err != nil {
+		respondWithServiceError(w, err, "Failed to update profile")
+		return
+	}
+
+	message := "Profile updated"
+	if thisRequest.NewPassword != nil {
+		if err := s.Logins.RevokeOtherSessions(user.ID, userDetails.SessionID); err != nil {
+			log.Printf("Failed to end other sessions of user %d: %v", user.ID, err)
+		}
+		message += ". Your other sessions have been signed out"
+	}
+	if changes.Email != nil {
+		if err := s.sendVerificationEmail(r.Context(), user.ID, fullname, email); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+		message += ". Verify your new email address before your next login"
+	}
+
+	profile, err := s.Users.Profile(r.Context(), user.ID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to load profile")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": message,
+		"profile": profile,
+	})
+}
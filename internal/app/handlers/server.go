@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+)
+
+// Server holds the authentication and ownership policy every route goes
+// through, and the repositories every handler reaches storage through, so
+// that the API can be tested against memory.
+type Server struct {
+	repository.Repositories
+	Auth   *auth.Authenticator
+	Policy *policy.Engine
+}
+
+// NewServer builds the authentication and the ownership policy on top of
+// repos.
+func NewServer(repos repository.Repositories) *Server {
+	return &Server{
+		Repositories: repos,
+		Auth: &auth.Authenticator{
+			IsRevoked:         repos.Logins.IsRevoked,
+			TouchSession:      repos.Logins.Touch,
+			HasRolePermission: repos.Permissions.HasPermission,
+			RecordEvent:       repos.Logins.RecordEvent,
+			ValidateAPIKey:    repos.APIKeys.Validate,
+			OAuthClientActive: repos.OAuthClients.Active,
+		},
+		Policy: policy.New(repos.Resources, repos.Permissions),
+	}
+}
+
+// Routes registers every endpoint of the API, all of them behind s.Auth and
+// s.Policy.
+func (s *Server) Routes(mux *http.ServeMux) {
+	authenticated := s.Auth.Middleware
+	require := s.Auth.RequirePermission
+
+	mux.HandleFunc("POST /register", s.RegisterUser)
+	mux.HandleFunc("POST /login", s.LoginUser)
+	mux.HandleFunc("POST /login/mfa", s.LoginMFA)
+	mux.HandleFunc("POST /login/mfa/enroll", s.EnrollMFAOnLogin)
+	mux.HandleFunc("POST /token/refresh", s.RefreshToken)
+	mux.HandleFunc("POST /logout", s.LogoutUser)
+	mux.HandleFunc("GET /verify-email", s.VerifyEmail)
+	mux.HandleFunc("POST /password/forgot", s.ForgotPassword)
+	mux.HandleFunc("POST /password/reset", s.ResetPassword)
+	mux.HandleFunc("GET /.well-known/jwks.json", GetJWKS)
+	mux.HandleFunc("POST /oauth/token", s.OAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", s.IntrospectToken)
+
+	mux.HandleFunc("POST /me/mfa", authenticated(auth.RequireUserLogin(s.EnrollMFA)))
+	mux.HandleFunc("POST /me/mfa/confirm", authenticated(auth.RequireUserLogin(s.ConfirmMFA)))
+	mux.HandleFunc("DELETE /me/mfa", authenticated(auth.RequireUserLogin(s.DisableMFA)))
+	mux.HandleFunc("GET /me", authenticated(s.GetMyProfile))
+	mux.HandleFunc("PATCH /me", authenticated(auth.RequireUserLogin(s.UpdateMyProfile)))
+	mux.HandleFunc("DELETE /me", authenticated(auth.RequireUserLogin(s.DeleteMyAccount)))
+	mux.HandleFunc("GET /me/export", authenticated(auth.RequireUserLogin(s.ExportMyData)))
+	mux.HandleFunc("GET /me/sessions", authenticated(auth.RequireUserLogin(s.GetMySessions)))
+	mux.HandleFunc("DELETE /me/sessions/{id}", authenticated(auth.RequireUserLogin(s.EndMySession)))
+	mux.HandleFunc("POST /api_keys", authenticated(auth.RequireUserLogin(s.CreateAPIKey)))
+	mux.HandleFunc("GET /api_keys", authenticated(auth.RequireUserLogin(s.GetMyAPIKeys)))
+	mux.HandleFunc("DELETE /api_keys/{id}", authenticated(auth.RequireUserLogin(s.RevokeAPIKey)))
+
+	mux.HandleFunc("POST /vehicles", authenticated(require("owner:create.vehicle", s.AddVehicle)))
+	mux.HandleFunc("GET /owned_vehicles", authenticated(require("owner:read.vehicle", s.GetMyVehicles)))
+	mux.HandleFunc("GET /vehicles", authenticated(require("admin:read.driver", s.GetAllVehicles)))
+	mux.HandleFunc("GET /vehicles/{id}", authenticated(s.GetVehicle))
+	mux.HandleFunc("PATCH /vehicles/{id}", authenticated(s.UpdateVehicle))
+	mux.HandleFunc("DELETE /vehicles/{id}", authenticated(s.DeleteVehicle))
+	mux.HandleFunc("PUT /vehicles/{id}/status", authenticated(s.UpdateVehicleStatus))
+	mux.HandleFunc("GET /vehicles/{id}/status_history", authenticated(s.GetVehicleStatusHistory))
+	mux.HandleFunc("PUT /vehicles/{id}/assign_driver", authenticated(require("admin:assign.driver", s.AssignDriver)))
+	mux.HandleFunc("PUT /vehicles/{id}/unassign_driver", authenticated(require("admin:assign.driver", s.UnassignDriver)))
+	mux.HandleFunc("PUT /vehicles/{id}/reassign_driver", authenticated(require("admin:assign.driver", s.ReassignDriver)))
+	mux.HandleFunc("GET /vehicles/{id}/assignments", authenticated(s.GetVehicleAssignments))
+	mux.HandleFunc("GET /drivers", authenticated(require("admin:read.driver", s.GetAllDrivers)))
+	mux.HandleFunc("GET /drivers/{id}/assignments", authenticated(s.GetDriverAssignments))
+	mux.HandleFunc("GET /vehicle_owners", authenticated(require("admin:read.owner", s.GetAllOwners)))
+
+	mux.HandleFunc("POST /users/{id}/revoke_tokens", authenticated(require("admin:revoke.token", s.RevokeUserTokens)))
+	mux.HandleFunc("POST /users/{id}/verification_email", authenticated(require("admin:verify.user", s.ResendVerificationEmail)))
+	mux.HandleFunc("POST /users/{id}/verify", authenticated(require("admin:verify.user", s.ForceVerifyEmail)))
+	mux.HandleFunc("POST /users/{id}/unlock", authenticated(require("admin:unlock.user", s.UnlockUser)))
+	mux.HandleFunc("GET /users/{id}/sessions", authenticated(require("admin:manage.sessions", s.GetUserSessions)))
+	mux.HandleFunc(
+		"DELETE /users/{id}/sessions/{session_id}",
+		authenticated(require("admin:manage.sessions", s.EndUserSession)),
+	)
+	mux.HandleFunc(
+		"POST /users/{id}/impersonate",
+		authenticated(auth.RequireUserLogin(require("admin:impersonate.user", s.ImpersonateUser))),
+	)
+	mux.HandleFunc("PUT /users/{id}/role", authenticated(require("admin:assign.role", s.SetUserRole)))
+
+	mux.HandleFunc("GET /oauth/clients", authenticated(require("admin:manage.clients", s.GetAllOAuthClients)))
+	mux.HandleFunc(
+		"POST /oauth/clients",
+		authenticated(auth.RequireUserLogin(require("admin:manage.clients", s.CreateOAuthClient))),
+	)
+	mux.HandleFunc("DELETE /oauth/clients/{id}", authenticated(require("admin:manage.clients", s.RevokeOAuthClient)))
+
+	mux.HandleFunc("GET /roles", authenticated(require("admin:manage.roles", s.GetAllRoles)))
+	mux.HandleFunc("POST /roles", authenticated(require("admin:manage.roles", s.CreateRole)))
+	mux.HandleFunc("DELETE /roles/{id}", authenticated(require("admin:manage.roles", s.DeleteRole)))
+	mux.HandleFunc("PUT /roles/{id}/permissions/{permission_id}", authenticated(require("admin:manage.roles", s.GrantPermission)))
+	mux.HandleFunc(
+		"DELETE /roles/{id}/permissions/{permission_id}",
+		authenticated(require("admin:manage.roles", s.RevokePermission)),
+	)
+	mux.HandleFunc("PUT /roles/{id}/mfa", authenticated(require("admin:manage.roles", s.SetRoleMFA)))
+	mux.HandleFunc("GET /permissions", authenticated(require("admin:manage.roles", s.GetAllPermissions)))
+	mux.HandleFunc("POST /permissions", authenticated(require("admin:manage.roles", s.CreatePermission)))
+	mux.HandleFunc("DELETE /permissions/{id}", authenticated(require("admin:manage.roles", s.DeletePermission)))
+}
+
+// authorize runs the ownership policy for the authenticated user and writes
+// the error response itself when the action isn't allowed.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, action policy.Action, resource policy.Resource) bool {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return false
+	}
+
+	err := s.Policy.AuthorizeClaims(r.Context(), userDetails, action, resource)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, policy.ErrNotFound):
+		respondWithError(w, "Resource not found", http.StatusNotFound)
+	case errors.Is(err, policy.ErrForbidden):
+		respondWithError(w, "Forbidden", http.StatusForbidden)
+	default:
+		log.Printf("Failed to evaluate policy %s: %v", action, err)
+		respondWithError(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// actorOf is the caller the claims describe, to the service layer.
+func (s *Server) actorOf(claims *auth.UserClaims) service.Actor {
+	return service.Actor{
+		UserID: claims.UserID,
+		HasPermission: func(permission string) (bool, error) {
+			return s.Auth.HasPermission(claims, permission)
+		},
+	}
+}
+
+// parsePage reads the page and limit query parameters, defaulting to the
+// first page of 10.
+func parsePage(r *http.Request) repository.Page {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	return repository.Page{Number: page, Limit: limit}
+}
@@ -0,0 +1,779 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/repository/memory"
+	"github.com/kwagmire/fleet-management-api/internal/app/repository/sqlstore"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db/dbtest"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
+)
+
+const testPassword = "correct-horse-battery"
+
+type testServer struct {
+	t     *testing.T
+	store testStore
+	mux   *http.ServeMux
+}
+
+// testStore is the storage a testServer runs on, with what the tests need to
+// set up users behind the API's back.
+type testStore interface {
+	Repositories() repository.Repositories
+	AddUser(name, email, passwordHash, role string) (int, error)
+	VerifyEmail(userID int)
+	Grant(role string, permissions ...string)
+	Events() []auth.Event
+}
+
+// eachServer runs test on a server backed by a memory store and on one backed
+// by a fresh SQLite database.
+func eachServer(t *testing.T, test func(t *testing.T, s *testServer)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestServer(t, newMemoryStore()))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestServer(t, newSQLStore(t)))
+	})
+}
+
+// newTestServer serves the Server's routes from store.
+func newTestServer(t *testing.T, store testStore) *testServer {
+	t.Helper()
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+
+	mux := http.NewServeMux()
+	NewServer(store.Repositories()).Routes(mux)
+	return &testServer{t: t, store: store, mux: mux}
+}
+
+// newMemoryStore sets up a memory store with the roles and permissions of a
+// fresh database.
+func newMemoryStore() *memory.Store {
+	store := memory.New()
+	store.AllowSelfRegistration("driver", "vehicle_owner")
+	store.Grant(
+		"vehicle_owner",
+		"owner:create.vehicle",
+		"owner:read.vehicle",
+		"owner:update.vehicle",
+		"owner:delete.vehicle",
+		"owner:delete.owner",
+	)
+	store.Grant("driver", "driver:update.vehicle", "driver:update.driver", "driver:delete.driver")
+	store.Grant(
+		"super_admin",
+		"admin:read.vehicle",
+		"admin:read.driver",
+		"admin:read.owner",
+		"admin:assign.driver",
+		"admin:assign.role",
+		"admin:update.vehicle",
+		"admin:update.driver",
+		"admin:update.owner",
+		"admin:delete.vehicle",
+		"admin:delete.driver",
+		"admin:delete.owner",
+		"admin:impersonate.user",
+		"admin:manage.clients",
+		"admin:manage.roles",
+		"admin:manage.sessions",
+		"admin:revoke.token",
+		"admin:unlock.user",
+		"admin:verify.user",
+	)
+	return store
+}
+
+type sqlStore struct {
+	t *testing.T
+}
+
+// newSQLStore migrates a fresh SQLite database. Admins log in without MFA,
+// as they do on a memory store.
+func newSQLStore(t *testing.T) sqlStore {
+	dbtest.Fresh(t)
+	if _, err := db.DB.Exec("UPDATE roles SET mfa_required = FALSE"); err != nil {
+		t.Fatal(err)
+	}
+	return sqlStore{t: t}
+}
+
+func (sqlStore) Repositories() repository.Repositories {
+	return sqlstore.New()
+}
+
+func (sqlStore) AddUser(name, email, passwordHash, role string) (int, error) {
+	var userID int
+	err := db.DB.QueryRow(
+		"INSERT INTO users (fullname, email, password_hash, role, email_verified_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP) RETURNING id",
+		name, email, passwordHash, role,
+	).Scan(&userID)
+	return userID, err
+}
+
+func (s sqlStore) VerifyEmail(userID int) {
+	if _, err := db.DB.Exec("UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = $1", userID); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// Grant creates role if it doesn't exist yet and grants it permissions, which
+// must exist.
+func (s sqlStore) Grant(role string, permissions ...string) {
+	if _, err := db.DB.Exec("INSERT INTO roles (name) VALUES ($1) ON CONFLICT DO NOTHING", role); err != nil {
+		s.t.Fatal(err)
+	}
+	for _, permission := range permissions {
+		_, err := db.DB.Exec(`
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT r.id, p.id FROM roles AS r, permissions AS p
+			WHERE r.name = $1 AND p.name = $2
+			ON CONFLICT DO NOTHING`,
+			role, permission,
+		)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	auth.Permissions.Invalidate(role)
+}
+
+func (s sqlStore) Events() []auth.Event {
+	rows, err := db.DB.Query("SELECT COALESCE(user_id, 0), event_type FROM auth_events ORDER BY id")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer rows.Close()
+	var events []auth.Event
+	for rows.Next() {
+		var e auth.Event
+		if err := rows.Scan(&e.UserID, &e.Type); err != nil {
+			s.t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		s.t.Fatal(err)
+	}
+	return events
+}
+
+func (s *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	return w
+}
+
+func (s *testServer) register(name, email, role, licenseID string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	body := map[string]interface{}{
+		"fullname": name,
+		"email":    email,
+		"password": testPassword,
+		"role":     role,
+	}
+	if licenseID != "" {
+		body["license_id"] = licenseID
+	}
+	return s.do(http.MethodPost, "/register", "", body)
+}
+
+func (s *testServer) login(email, pw string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(http.MethodPost, "/login", "", map[string]string{"email": email, "password": pw})
+}
+
+// user registers a verified user of role and returns their ID and a token.
+func (s *testServer) user(name, email, role, licenseID string) (int, string) {
+	s.t.Helper()
+	if w := s.register(name, email, role, licenseID); w.Code != http.StatusCreated {
+		s.t.Fatalf("register %s: got %d %s", email, w.Code, w.Body)
+	}
+	userID := s.verify(email)
+	return userID, s.token(email)
+}
+
+func (s *testServer) verify(email string) int {
+	s.t.Helper()
+	creds, err := s.store.Repositories().Users.Credentials(context.Background(), email)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.store.VerifyEmail(creds.UserID)
+	return creds.UserID
+}
+
+func (s *testServer) admin() string {
+	s.t.Helper()
+	hash, err := password.Hash(testPassword)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if _, err := s.store.AddUser("Admin", "admin@example.com", hash, "super_admin"); err != nil {
+		s.t.Fatal(err)
+	}
+	return s.token("admin@example.com")
+}
+
+func (s *testServer) token(email string) string {
+	s.t.Helper()
+	var resp map[string]string
+	decode(s.t, s.login(email, testPassword), http.StatusOK, &resp)
+	return resp["token"]
+}
+
+func (s *testServer) addVehicle(token, plate string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(http.MethodPost, "/vehicles", token, map[string]interface{}{
+		"make":          "Toyota",
+		"model":         "Corolla",
+		"year":          2020,
+		"license_plate": plate,
+	})
+}
+
+func (s *testServer) assign(token string, vehicleID, driverID int) *httptest.ResponseRecorder {
+	s.t.Helper()
+	path := "/vehicles/" + strconv.Itoa(vehicleID) + "/assign_driver"
+	return s.do(http.MethodPut, path, token, map[string]string{"driver_id": strconv.Itoa(driverID)})
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response body %q: %v", w.Body, err)
+	}
+}
+
+func TestRegisterUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		role      string
+		licenseID string
+		want      int
+	}{
+		{"owner", "owner@example.com", "vehicle_owner", "", http.StatusCreated},
+		{"driver", "driver@example.com", "driver", "LIC-1", http.StatusCreated},
+		{"duplicate email", "owner@example.com", "vehicle_owner", "", http.StatusConflict},
+		{"duplicate license", "driver2@example.com", "driver", "LIC-1", http.StatusConflict},
+		{"driver without license", "driver3@example.com", "driver", "", http.StatusBadRequest},
+		{"admin role", "admin@example.com", "super_admin", "", http.StatusBadRequest},
+		{"invalid email", "not-an-email", "vehicle_owner", "", http.StatusBadRequest},
+	}
+
+	eachServer(t, func(t *testing.T, s *testServer) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := s.register("Test User", tt.email, tt.role, tt.licenseID); w.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+	})
+}
+
+func TestRegisterUserRejectsWeakPassword(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		w := s.do(http.MethodPost, "/register", "", map[string]string{
+			"fullname": "Test User",
+			"email":    "owner@example.com",
+			"password": "short",
+			"role":     "vehicle_owner",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestLoginUser(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		if w := s.register("Test Owner", "owner@example.com", "vehicle_owner", ""); w.Code != http.StatusCreated {
+			t.Fatalf("register: got %d %s", w.Code, w.Body)
+		}
+
+		if w := s.login("owner@example.com", testPassword); w.Code != http.StatusForbidden {
+			t.Errorf("unverified email: got status %d, want %d", w.Code, http.StatusForbidden)
+		}
+
+		s.verify("owner@example.com")
+
+		if w := s.login("owner@example.com", "wrong-password"); w.Code != http.StatusUnauthorized {
+			t.Errorf("wrong password: got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := s.login("nobody@example.com", testPassword); w.Code != http.StatusUnauthorized {
+			t.Errorf("unknown email: got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		var resp map[string]string
+		decode(t, s.login("owner@example.com", testPassword), http.StatusOK, &resp)
+		if resp["token"] == "" || resp["refresh_token"] == "" {
+			t.Errorf("got response %v, want a token and a refresh token", resp)
+		}
+		if w := s.do(http.MethodGet, "/owned_vehicles", resp["token"], nil); w.Code != http.StatusOK {
+			t.Errorf("request with the token: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		userID := s.verify("owner@example.com")
+		succeeded := 0
+		for _, e := range s.store.Events() {
+			if e.Type == auth.EventLoginSucceeded && e.UserID == userID {
+				succeeded++
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("recorded %d successful logins, want 1", succeeded)
+		}
+	})
+}
+
+func TestLoginUserLocksAccount(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+
+		// The first failures are free, the next one locks the account
+		for i := 0; i < 6; i++ {
+			if w := s.login("owner@example.com", "wrong-password"); w.Code != http.StatusUnauthorized {
+				t.Fatalf("attempt %d: got status %d, want %d", i+1, w.Code, http.StatusUnauthorized)
+			}
+		}
+
+		w := s.login("owner@example.com", testPassword)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("no Retry-After header")
+		}
+	})
+}
+
+func TestAddVehicle(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		_, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+		_, driver := s.user("Test Driver", "driver@example.com", "driver", "LIC-1")
+
+		if w := s.addVehicle(owner, "ABC-123"); w.Code != http.StatusCreated {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+		}
+
+		tests := []struct {
+			name  string
+			token string
+			plate string
+			want  int
+		}{
+			{"duplicate plate", owner, "ABC-123", http.StatusConflict},
+			{"plate too long", owner, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusBadRequest},
+			{"missing plate", owner, "", http.StatusBadRequest},
+			{"driver", driver, "XYZ-789", http.StatusForbidden},
+			{"no token", "", "XYZ-789", http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := s.addVehicle(tt.token, tt.plate); w.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+	})
+}
+
+func TestListVehicles(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		_, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+		_, otherOwner := s.user("Other Owner", "other@example.com", "vehicle_owner", "")
+		admin := s.admin()
+		for _, plate := range []string{"OWN-1", "OWN-2"} {
+			if w := s.addVehicle(owner, plate); w.Code != http.StatusCreated {
+				t.Fatalf("add vehicle: got %d %s", w.Code, w.Body)
+			}
+		}
+		if w := s.addVehicle(otherOwner, "OTHER-1"); w.Code != http.StatusCreated {
+			t.Fatalf("add vehicle: got %d %s", w.Code, w.Body)
+		}
+
+		var owned struct {
+			Data []struct {
+				LicensePlate string `json:"license_plate"`
+				Status       string `json:"status"`
+			} `json:"data"`
+			FleetSize int `json:"fleet_size"`
+		}
+		decode(t, s.do(http.MethodGet, "/owned_vehicles", owner, nil), http.StatusOK, &owned)
+		if len(owned.Data) != 2 || owned.FleetSize != 2 {
+			t.Errorf("owner sees %d vehicles and fleet size %d, want 2 and 2", len(owned.Data), owned.FleetSize)
+		}
+		for _, v := range owned.Data {
+			if v.Status != "available" {
+				t.Errorf("vehicle %s has status %q, want available", v.LicensePlate, v.Status)
+			}
+		}
+
+		var all struct {
+			Data      []json.RawMessage `json:"data"`
+			Page      int               `json:"page"`
+			Limit     int               `json:"limit"`
+			Total     int               `json:"total"`
+			FleetSize int               `json:"fleet_size"`
+		}
+		decode(t, s.do(http.MethodGet, "/vehicles?page=2&limit=2", admin, nil), http.StatusOK, &all)
+		if all.Page != 2 || all.Limit != 2 || all.Total != 1 || all.FleetSize != 3 {
+			t.Errorf("got page %d, limit %d, total %d and fleet size %d, want 2, 2, 1 and 3",
+				all.Page, all.Limit, all.Total, all.FleetSize)
+		}
+
+		var owners struct {
+			Total int `json:"total_vehicle_owners"`
+		}
+		decode(t, s.do(http.MethodGet, "/vehicle_owners", admin, nil), http.StatusOK, &owners)
+		if owners.Total != 2 {
+			t.Errorf("got %d vehicle owners, want 2", owners.Total)
+		}
+
+		if w := s.do(http.MethodGet, "/vehicles", owner, nil); w.Code != http.StatusForbidden {
+			t.Errorf("owner listing all vehicles: got status %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+}
+
+func TestAssignDriver(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		_, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+		driverID, _ := s.user("Test Driver", "driver@example.com", "driver", "LIC-1")
+		otherDriverID, _ := s.user("Other Driver", "other@example.com", "driver", "LIC-2")
+		admin := s.admin()
+		for _, plate := range []string{"CAR-1", "CAR-2"} {
+			if w := s.addVehicle(owner, plate); w.Code != http.StatusCreated {
+				t.Fatalf("add vehicle: got %d %s", w.Code, w.Body)
+			}
+		}
+		var owned struct {
+			Data []struct {
+				ID int `json:"id"`
+			} `json:"data"`
+		}
+		decode(t, s.do(http.MethodGet, "/owned_vehicles", owner, nil), http.StatusOK, &owned)
+		first, second := owned.Data[0].ID, owned.Data[1].ID
+
+		if w := s.assign(owner, first, driverID); w.Code != http.StatusForbidden {
+			t.Errorf("owner assigning: got status %d, want %d", w.Code, http.StatusForbidden)
+		}
+		if w := s.assign(admin, first, driverID); w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		tests := []struct {
+			name      string
+			vehicleID int
+			driverID  int
+			want      int
+		}{
+			{"driver already assigned", second, driverID, http.StatusConflict},
+			{"vehicle in use", first, otherDriverID, http.StatusConflict},
+			{"unknown driver", second, 9999, http.StatusNotFound},
+			{"unknown vehicle", 9999, otherDriverID, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := s.assign(admin, tt.vehicleID, tt.driverID); w.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+
+		var drivers struct {
+			Data []struct {
+				UserID   int  `json:"user_id"`
+				Assigned bool `json:"assigned"`
+			} `json:"data"`
+		}
+		decode(t, s.do(http.MethodGet, "/drivers", admin, nil), http.StatusOK, &drivers)
+		for _, d := range drivers.Data {
+			if want := d.UserID == driverID; d.Assigned != want {
+				t.Errorf("driver %d assigned is %v, want %v", d.UserID, d.Assigned, want)
+			}
+		}
+
+		var vehicles struct {
+			Data []struct {
+				ID     int    `json:"id"`
+				Status string `json:"status"`
+			} `json:"data"`
+		}
+		decode(t, s.do(http.MethodGet, "/owned_vehicles", owner, nil), http.StatusOK, &vehicles)
+		for _, v := range vehicles.Data {
+			want := "available"
+			if v.ID == first {
+				want = "in_use"
+			}
+			if v.Status != want {
+				t.Errorf("vehicle %d has status %q, want %q", v.ID, v.Status, want)
+			}
+		}
+	})
+}
+
+func TestUpdateAndDeleteVehicle(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		_, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+		_, otherOwner := s.user("Other Owner", "other@example.com", "vehicle_owner", "")
+		driverID, _ := s.user("Test Driver", "driver@example.com", "driver", "LIC-1")
+		admin := s.admin()
+		for _, plate := range []string{"CAR-1", "CAR-2"} {
+			if w := s.addVehicle(owner, plate); w.Code != http.StatusCreated {
+				t.Fatalf("add vehicle: got %d %s", w.Code, w.Body)
+			}
+		}
+		var owned struct {
+			Data []struct {
+				ID int `json:"id"`
+			} `json:"data"`
+		}
+		decode(t, s.do(http.MethodGet, "/owned_vehicles", owner, nil), http.StatusOK, &owned)
+		first, second := owned.Data[0].ID, owned.Data[1].ID
+		path := "/vehicles/" + strconv.Itoa(first)
+
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			token  string
+			body   interface{}
+			want   int
+		}{
+			{"owner reads", http.MethodGet, path, owner, nil, http.StatusOK},
+			{"other owner reads", http.MethodGet, path, otherOwner, nil, http.StatusForbidden},
+			{"unknown vehicle", http.MethodGet, "/vehicles/9999", admin, nil, http.StatusNotFound},
+			{"other owner updates", http.MethodPatch, path, otherOwner, map[string]string{"model": "Yaris"}, http.StatusForbidden},
+			{"no fields", http.MethodPatch, path, owner, map[string]string{}, http.StatusBadRequest},
+			{"empty make", http.MethodPatch, path, owner, map[string]string{"make": " "}, http.StatusBadRequest},
+			{"old year", http.MethodPatch, path, owner, map[string]int{"year": 1990}, http.StatusBadRequest},
+			{"taken plate", http.MethodPatch, path, owner, map[string]string{"license_plate": "CAR-2"}, http.StatusConflict},
+			{"other owner deletes", http.MethodDelete, path, otherOwner, nil, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := s.do(tt.method, tt.path, tt.token, tt.body); w.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+
+		var updated struct {
+			Vehicle struct {
+				Model        string `json:"model"`
+				LicensePlate string `json:"license_plate"`
+			} `json:"vehicle"`
+		}
+		changes := map[string]string{"model": "Yaris", "license_plate": "CAR-1"}
+		decode(t, s.do(http.MethodPatch, path, owner, changes), http.StatusOK, &updated)
+		if updated.Vehicle.Model != "Yaris" || updated.Vehicle.LicensePlate != "CAR-1" {
+			t.Errorf("got model %q and plate %q, want Yaris and CAR-1", updated.Vehicle.Model, updated.Vehicle.LicensePlate)
+		}
+
+		if w := s.assign(admin, first, driverID); w.Code != http.StatusOK {
+			t.Fatalf("assign: got %d %s", w.Code, w.Body)
+		}
+		if w := s.do(http.MethodDelete, path, owner, nil); w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		if w := s.do(http.MethodGet, path, admin, nil); w.Code != http.StatusNotFound {
+			t.Errorf("deleted vehicle: got status %d, want %d", w.Code, http.StatusNotFound)
+		}
+
+		var fleet struct {
+			Data []struct {
+				ID int `json:"id"`
+			} `json:"data"`
+			FleetSize int `json:"fleet_size"`
+		}
+		decode(t, s.do(http.MethodGet, "/owned_vehicles", owner, nil), http.StatusOK, &fleet)
+		if fleet.FleetSize != 1 || len(fleet.Data) != 1 || fleet.Data[0].ID != second {
+			t.Errorf("got fleet size %d and vehicles %v, want 1 and vehicle %d", fleet.FleetSize, fleet.Data, second)
+		}
+		if w := s.assign(admin, second, driverID); w.Code != http.StatusOK {
+			t.Errorf("assigning the released driver: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+	})
+}
+
+func TestCurrentPasswordLocksAccount(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		_, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+
+		wrong := map[string]string{"current_password": "wrong-password", "new_password": "another-horse-battery"}
+		for i := 0; i < 6; i++ {
+			if w := s.do(http.MethodPatch, "/me", owner, wrong); w.Code != http.StatusForbidden {
+				t.Fatalf("attempt %d: got status %d, want %d: %s", i+1, w.Code, http.StatusForbidden, w.Body)
+			}
+		}
+
+		w := s.do(http.MethodDelete, "/me", owner, map[string]string{"current_password": testPassword})
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusTooManyRequests, w.Body)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("no Retry-After header")
+		}
+		if w := s.login("owner@example.com", testPassword); w.Code != http.StatusTooManyRequests {
+			t.Errorf("login: got status %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+	})
+}
+
+func TestDeleteMyAccount(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		ownerID, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+
+		if w := s.do(http.MethodDelete, "/me", owner, map[string]string{"current_password": testPassword}); w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		if w := s.do(http.MethodGet, "/me", owner, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("token of the deleted account: got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := s.login("owner@example.com", testPassword); w.Code != http.StatusUnauthorized {
+			t.Errorf("login: got status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		// Other instances learn about the revocation from the database
+		if _, ok := s.store.(sqlStore); ok {
+			var cutoffs, active, ended int
+			err := db.DB.QueryRow("SELECT COUNT(*) FROM user_token_revocations WHERE user_id = $1", ownerID).Scan(&cutoffs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.DB.QueryRow(
+				"SELECT COUNT(*) FILTER (WHERE revoked_at IS NULL), COUNT(*) FILTER (WHERE revoked_at IS NOT NULL) FROM sessions WHERE user_id = $1",
+				ownerID,
+			).Scan(&active, &ended)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cutoffs != 1 || active != 0 || ended != 1 {
+				t.Errorf("got %d revocation cutoffs, %d active and %d ended sessions, want 1, 0 and 1", cutoffs, active, ended)
+			}
+		}
+
+		admin := s.admin()
+		for _, action := range []string{"verification_email", "verify"} {
+			path := "/users/" + strconv.Itoa(ownerID) + "/" + action
+			if w := s.do(http.MethodPost, path, admin, nil); w.Code != http.StatusNotFound {
+				t.Errorf("%s: got status %d, want %d: %s", action, w.Code, http.StatusNotFound, w.Body)
+			}
+		}
+	})
+}
+
+// Clients act as a user like impersonation does, so they are registered by
+// admins holding the user's permissions.
+func TestCreateOAuthClient(t *testing.T) {
+	eachServer(t, func(t *testing.T, s *testServer) {
+		ownerID, owner := s.user("Test Owner", "owner@example.com", "vehicle_owner", "")
+		deletedID, deleted := s.user("Gone Owner", "gone@example.com", "vehicle_owner", "")
+		if w := s.do(http.MethodDelete, "/me", deleted, map[string]string{"current_password": testPassword}); w.Code != http.StatusOK {
+			t.Fatalf("delete account: got %d %s", w.Code, w.Body)
+		}
+
+		hash, err := password.Hash(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.store.Grant("client_admin", "admin:manage.clients")
+		clientAdminID, err := s.store.AddUser("Client Admin", "clients@example.com", hash, "client_admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientAdmin := s.token("clients@example.com")
+		s.store.Grant(
+			"support",
+			"admin:manage.clients",
+			"owner:create.vehicle",
+			"owner:read.vehicle",
+			"owner:update.vehicle",
+			"owner:delete.vehicle",
+			"owner:delete.owner",
+		)
+		if _, err := s.store.AddUser("Support", "support@example.com", hash, "support"); err != nil {
+			t.Fatal(err)
+		}
+		support := s.token("support@example.com")
+
+		request := func(userID int, scopes ...string) map[string]interface{} {
+			return map[string]interface{}{"name": "Telematics", "user_id": userID, "scopes": scopes}
+		}
+		tests := []struct {
+			name  string
+			token string
+			body  interface{}
+			want  int
+		}{
+			{"caller lacks the scope", clientAdmin, request(ownerID, "owner:read.vehicle"), http.StatusForbidden},
+			{"admin target", support, request(clientAdminID, "admin:manage.clients"), http.StatusForbidden},
+			{"deleted target", support, request(deletedID, "owner:read.vehicle"), http.StatusNotFound},
+			{"scope the target lacks", support, request(ownerID, "admin:manage.clients"), http.StatusBadRequest},
+			{"without the permission", owner, request(ownerID, "owner:read.vehicle"), http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := s.do(http.MethodPost, "/oauth/clients", tt.token, tt.body); w.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+
+		t.Run("API key", func(t *testing.T) {
+			var key struct {
+				Key string `json:"key"`
+			}
+			keyRequest := map[string]interface{}{"name": "automation", "scopes": []string{"admin:manage.clients", "owner:read.vehicle"}}
+			decode(t, s.do(http.MethodPost, "/api_keys", support, keyRequest), http.StatusCreated, &key)
+
+			body, err := json.Marshal(request(ownerID, "owner:read.vehicle"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/oauth/clients", bytes.NewReader(body))
+			r.Header.Set(auth.APIKeyHeader, key.Key)
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("got status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+			}
+		})
+
+		var client struct {
+			ClientID string `json:"client_id"`
+		}
+		decode(t, s.do(http.MethodPost, "/oauth/clients", support, request(ownerID, "owner:read.vehicle")), http.StatusCreated, &client)
+		if client.ClientID == "" {
+			t.Error("no client ID")
+		}
+	})
+}
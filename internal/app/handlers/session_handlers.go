@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// @Summary Refresh an access token
+// @Description Exchanges a refresh token for a new access token and a new refresh token
+// @Accept  json
+// @Produce json
+// @Param   token  body  models.RefreshTokenRequest  true  "Refresh token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 401 {string} string "Invalid or expired refresh token"
+// @Router /token/refresh [post]
+func (s *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.RefreshTokenRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.RefreshToken == "" {
+		respondWithError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, sessionID, refreshToken, err := s.Logins.RotateRefreshToken(thisRequest.RefreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected, session revoked")
+		respondWithError(w, "Refresh token has already been used. Please login again", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		respondWithError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Failed to refresh session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to load role for session %s: %v", sessionID, err)
+		respondWithError(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := auth.GenerateToken(userID, user.Role, sessionID)
+	if err != nil {
+		respondWithError(w, "Failed to generate authentication token", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message":       "Token refreshed",
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
+}
+
+// @Summary Log a user out
+// @Description Revokes the session the refresh token belongs to, and the access token if one is sent
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   token  body  models.RefreshTokenRequest  true  "Refresh token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid request payload"
+// @Router /logout [post]
+func (s *Server) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.RefreshTokenRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.RefreshToken == "" {
+		respondWithError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Logins.RevokeSessionByRefreshToken(thisRequest.RefreshToken); err != nil {
+		respondWithError(w, "Failed to logout: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The access token is optional here, but if it is sent along it should
+	// stop working right away instead of living out its expiry.
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if claims, err := auth.ValidateToken(tokenString); err == nil {
+		if err := s.Logins.RevokeToken(claims); err != nil {
+			log.Printf("Failed to revoke access token on logout: %v", err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Logout successful"})
+}
+
+// @Summary List my sessions
+// @Description Lists the devices the current user is logged in on. The session of the calling token is marked as current
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} models.Session
+// @Router /me/sessions [get]
+func (s *Server) GetMySessions(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	s.respondWithSessions(w, userDetails.UserID, userDetails.SessionID)
+}
+
+// @Summary Sign out a session
+// @Description Ends one of the current user's sessions, e.g. on a lost phone. Its refresh and access tokens stop working
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  string  true  "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {string} string "Session not found"
+// @Router /me/sessions/{id} [delete]
+func (s *Server) EndMySession(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	s.endSession(w, userDetails.UserID, r.PathValue("id"))
+}
+
+func (s *Server) GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	s.respondWithSessions(w, userID, "")
+}
+
+func (s *Server) EndUserSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	adminDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if s.endSession(w, userID, r.PathValue("session_id")) {
+		log.Printf("Admin %d ended session of user %d", adminDetails.UserID, userID)
+	}
+}
+
+func (s *Server) respondWithSessions(w http.ResponseWriter, userID int, currentSessionID string) {
+	sessions, err := s.Logins.Sessions(userID)
+	if err != nil {
+		respondWithError(w, "Failed to retrieve sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) endSession(w http.ResponseWriter, userID int, sessionID string) bool {
+	if sessionID == "" {
+		respondWithError(w, "Session ID not found in URL", http.StatusBadRequest)
+		return false
+	}
+
+	ended, err := s.Logins.EndSession(userID, sessionID)
+	if err != nil {
+		respondWithError(w, "Failed to end session: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !ended {
+		respondWithError(w, "Session not found", http.StatusNotFound)
+		return false
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Session ended"})
+	return true
+}
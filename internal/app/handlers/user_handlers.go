@@ -1,17 +1,22 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"net/mail"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
 	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
-	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
 	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
-
-	"github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/password"
 )
 
 // @Summary Register a new user
@@ -24,7 +29,7 @@ import (
 // @Failure 400 {string} string "Invalid request payload"
 // @Failure 403 {string} string "User exists"
 // @Router /register [post]
-func RegisterUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
 		return
@@ -47,8 +52,12 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, "Email, name or role can't be empty", http.StatusBadRequest)
 		return
 	}
-	if len(thisRequest.Password) < 8 {
-		respondWithError(w, "Password must be at least 8 characters long", http.StatusBadRequest)
+	if address, err := mail.ParseAddress(thisRequest.Email); err != nil || address.Address != thisRequest.Email {
+		respondWithError(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if err := password.Check(thisRequest.Password, thisRequest.Name, thisRequest.Email); err != nil {
+		respondWithError(w, "Invalid password: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	if thisRequest.Role == "driver" && (thisRequest.LicenseID == nil || *thisRequest.LicenseID == "") {
@@ -56,61 +65,32 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(thisRequest.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(thisRequest.Password)
 	if err != nil {
 		respondWithError(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
-	query := `
-		INSERT INTO users (
-			fullname,
-			password_hash,
-			email,
-			role
-		) VALUES ($1, $2, $3, $4
-		) RETURNING id`
-	var userID int
-	err = db.DB.QueryRow(query, thisRequest.Name, string(hashedPassword), thisRequest.Email, thisRequest.Role).Scan(&userID)
-	if err != nil {
-		if dbError, ok := err.(*pq.Error); ok && dbError.Code.Name() == "unique_violation" {
-			http.Error(w, "Email already exists", http.StatusConflict)
-			return
-		} else if ok && dbError.Code.Name() == "check_violation" {
-			http.Error(w, "User can only register as a driver or vehicle_owner", http.StatusBadRequest)
-			return
-		}
-		respondWithError(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if thisRequest.Role == "driver" {
-		query = `
-			INSERT INTO drivers (
-				user_id,
-				license_id
-			) VALUES ($1, $2);`
-		_, err = db.DB.Exec(query, userID, thisRequest.LicenseID)
-		if err != nil {
-			respondWithError(w, "Failed to register driver: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if thisRequest.Role == "vehicle_owner" {
-		query = `
-			INSERT INTO vehicle_owners (
-				user_id,
-				fleet_size
-			) VALUES ($1, $2);`
-		_, err = db.DB.Exec(query, userID, 0)
-		if err != nil {
-			respondWithError(w, "Failed to register vehicle_owner: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "User registration successful. Login to get started!"})
+	newUser := service.NewUser{
+		Name:         thisRequest.Name,
+		Email:        thisRequest.Email,
+		PasswordHash: hashedPassword,
+		Role:         thisRequest.Role,
+	}
+	if thisRequest.LicenseID != nil {
+		newUser.LicenseID = *thisRequest.LicenseID
+	}
+	userID, err := s.Users.Register(r.Context(), newUser)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to register user")
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), userID, thisRequest.Name, thisRequest.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "User registration successful. Check your email to verify your account before logging in"})
 }
 
 // @Summary Log a user in
@@ -121,9 +101,10 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 // @Param   user  body  models.LoginRequest  true  "User login credentials"
 // @Success 201 {object} map[string]string
 // @Failure 400 {string} string "Invalid request payload"
-// @Failure 401 {string} string "Unauthorized"
+// @Failure 401 {string} string "Invalid email or password"
+// @Failure 429 {string} string "Too many failed login attempts"
 // @Router /login [post]
-func LoginUser(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LoginUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
 		return
@@ -147,48 +128,171 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `
-		SELECT
-			u.id,
-			u.password_hash,
-			r.name,
-			array_agg(p.name) AS permission_list
-		FROM users AS u
-		JOIN roles AS r
-		ON u.role = r.name
-		JOIN role_permissions AS rp
-		ON r.id = rp.role_id
-		JOIN permissions AS p
-		ON rp.permission_id = p.id
-		WHERE u.email = $1
-		GROUP BY
-			u.id,
-			r.name;
-		`
-	var userID int
-	var hashedPassword string
-	var role string
-	var permissions []string
-	err = db.DB.QueryRow(query, thisRequest.Email).Scan(&userID, &hashedPassword, &role, (*pq.StringArray)(&permissions))
-	if err == sql.ErrNoRows {
-		respondWithError(w, "User account doesn't exist", http.StatusUnauthorized)
+	ip := auth.ClientIP(r)
+	lockedUntil, err := s.Logins.LockedUntil(auth.AccountKey(thisRequest.Email), auth.IPKey(ip))
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		s.Logins.RecordEvent(auth.Event{Type: auth.EventLoginBlocked, Email: thisRequest.Email, IP: ip})
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		respondWithError(w, "Too many failed login attempts. Try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	credentials, err := s.Users.Credentials(r.Context(), thisRequest.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Spend the same time as a wrong password would so response times
+		// don't tell which emails are registered
+		password.Verify(dummyPasswordHash(), thisRequest.Password)
+		s.recordLoginFailure(0, thisRequest.Email, ip)
+		respondWithError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID := credentials.UserID
+
+	matches, needsRehash, err := password.Verify(credentials.PasswordHash, thisRequest.Password)
+	if err != nil {
+		log.Printf("Failed to verify password of user %d: %v", userID, err)
+	}
+	if !matches {
+		s.recordLoginFailure(userID, thisRequest.Email, ip)
+		respondWithError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if needsRehash {
+		s.rehashPassword(r.Context(), userID, credentials.PasswordHash, thisRequest.Password)
+	}
+
+	if err := s.Logins.ResetFailures(auth.AccountKey(thisRequest.Email)); err != nil {
+		log.Printf("Failed to reset login failures of user %d: %v", userID, err)
+	}
+
+	if !credentials.EmailVerified {
+		respondWithError(w, "Email address not verified. Use the link sent to your inbox first", http.StatusForbidden)
 		return
 	}
+
+	mfaEnabled, mfaRequired, err := s.Logins.MFAStatus(userID)
 	if err != nil {
 		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if mfaEnabled || mfaRequired {
+		respondWithMFAChallenge(w, userID, !mfaEnabled)
+		return
+	}
+
+	s.issueLoginTokens(w, r, userID, credentials.Role)
+}
+
+// dummyPasswordHash is computed on first use so that it is made with the
+// hashing parameters configured at startup, like the real hashes.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := password.Hash("not-a-real-password")
+	return hash
+})
+
+// rehashPassword upgrades a hash made with an older algorithm or parameters
+// now that the plain password is at hand. Failing only means trying again on
+// the next login.
+func (s *Server) rehashPassword(ctx context.Context, userID int, oldHash, plain string) {
+	newHash, err := password.Hash(plain)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %d: %v", userID, err)
+		return
+	}
+	// Don't overwrite a password changed in the meantime
+	if err := s.Users.UpdatePasswordHash(ctx, userID, oldHash, newHash); err != nil {
+		log.Printf("Failed to store rehashed password of user %d: %v", userID, err)
+	}
+}
+
+// recordLoginFailure counts a failed login against both the account and the
+// client address and logs any lockout it causes.
+func (s *Server) recordLoginFailure(userID int, email, ip string) {
+	s.Logins.RecordEvent(auth.Event{UserID: userID, Type: auth.EventLoginFailed, Email: email, IP: ip})
+
+	lockedUntil, err := s.Logins.RecordFailure(auth.AccountKey(email), auth.AccountThrottle)
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	} else if !lockedUntil.IsZero() {
+		s.Logins.RecordEvent(auth.Event{
+			UserID:  userID,
+			Type:    auth.EventAccountLocked,
+			Email:   email,
+			IP:      ip,
+			Details: "locked until " + lockedUntil.Format(time.RFC3339),
+		})
+	}
+
+	lockedUntil, err = s.Logins.RecordFailure(auth.IPKey(ip), auth.IPThrottle)
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	} else if !lockedUntil.IsZero() {
+		s.Logins.RecordEvent(auth.Event{
+			Type:    auth.EventIPLocked,
+			Email:   email,
+			IP:      ip,
+			Details: "locked until " + lockedUntil.Format(time.RFC3339),
+		})
+	}
+}
+
+// reauthenticate checks the current password of a signed-in user against
+// hash, throttled like LoginUser so that a stolen token can't be used to guess
+// it. It writes the response itself when the password is refused. Changes
+// allowed by it are to be made only while the password hash is still hash.
+func (s *Server) reauthenticate(w http.ResponseWriter, r *http.Request, userID int, email, hash, plain string) bool {
+	ip := auth.ClientIP(r)
+	lockedUntil, err := s.Logins.LockedUntil(auth.AccountKey(email), auth.IPKey(ip))
+	if err != nil {
+		respondWithError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		s.Logins.RecordEvent(auth.Event{UserID: userID, Type: auth.EventLoginBlocked, Email: email, IP: ip})
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		respondWithError(w, "Too many failed password attempts. Try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	matches, _, err := password.Verify(hash, plain)
+	if err != nil {
+		log.Printf("Failed to verify password of user %d: %v", userID, err)
+	}
+	if !matches {
+		s.recordLoginFailure(userID, email, ip)
+		respondWithError(w, "Current password is incorrect", http.StatusForbidden)
+		return false
+	}
+	return true
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(thisRequest.Password)); err != nil {
-		respondWithError(w, "Invalid credentials", http.StatusUnauthorized)
+// issueLoginTokens starts a session and responds with its tokens.
+func (s *Server) issueLoginTokens(w http.ResponseWriter, r *http.Request, userID int, role string) {
+	ip := auth.ClientIP(r)
+	sessionID, refreshToken, err := s.Logins.CreateSession(userID, r.UserAgent(), ip)
+	if err != nil {
+		respondWithError(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
-	token, err := auth.GenerateToken(userID, role, permissions)
+	token, err := auth.GenerateToken(userID, role, sessionID)
 	if err != nil {
 		respondWithError(w, "Failed to generate authentication token", http.StatusInternalServerError)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Login successful!", "token": token})
+	s.Logins.RecordEvent(auth.Event{UserID: userID, Type: auth.EventLoginSucceeded, IP: ip})
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message":       "Login successful!",
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+const maxStatusReasonLength = 500
+
+// @Summary Change a vehicle's status
+// @Description Moves the vehicle to another status if the lifecycle allows it. A vehicle with a driver has to be unassigned before it can go to maintenance or out of service
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   id      path  int                                true  "Vehicle ID"
+// @Param   status  body  models.UpdateVehicleStatusRequest  true  "New status and reason"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Unknown vehicle status"
+// @Failure 403 {string} string "Not permitted to make this transition"
+// @Failure 409 {string} string "Can't change the vehicle's status"
+// @Router /vehicles/{id}/status [put]
+func (s *Server) UpdateVehicleStatus(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.authorize(w, r, policy.UpdateVehicle, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.UpdateVehicleStatusRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if thisRequest.Status == "" {
+		respondWithError(w, "Status is required", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(thisRequest.Reason)
+	if utf8.RuneCountInString(reason) > maxStatusReasonLength {
+		respondWithError(w, "Reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	to := vehiclestatus.Status(thisRequest.Status)
+	from, err := s.Vehicles.ChangeStatus(r.Context(), vehicleID, to, reason, s.actorOf(userDetails))
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to update vehicle status")
+		return
+	}
+
+	log.Printf("User %d moved vehicle %d from %s to %s", userDetails.UserID, vehicleID, from, to)
+
+	updated, err := s.Vehicles.Get(r.Context(), vehicleID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to retrieve vehicle")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Vehicle status updated successfully",
+		"vehicle": updated,
+	})
+}
+
+// @Summary Get a vehicle's status history
+// @Description Lists every status change of the vehicle, oldest first
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  int  true  "Vehicle ID"
+// @Success 200 {array} models.VehicleStatusTransition
+// @Failure 404 {string} string "Vehicle not found"
+// @Router /vehicles/{id}/status_history [get]
+func (s *Server) GetVehicleStatusHistory(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorize(w, r, policy.ReadVehicle, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	transitions, err := s.Vehicles.StatusHistory(r.Context(), vehicleID)
+	if err != nil {
+		respondWithError(w, "Failed to retrieve status history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, transitions)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+)
+
+// @Summary Get a vehicle
+// @Description Admins can read any vehicle, owners their own and drivers the one assigned to them
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  int  true  "Vehicle ID"
+// @Success 200 {object} models.Vehicle
+// @Failure 404 {string} string "Vehicle not found"
+// @Router /vehicles/{id} [get]
+func (s *Server) GetVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorize(w, r, policy.ReadVehicle, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	vehicle, err := s.Vehicles.Get(r.Context(), vehicleID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to retrieve vehicle")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, vehicle)
+}
+
+// @Summary Update a vehicle
+// @Description Changes the fields present in the body
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce json
+// @Param   id       path  int                          true  "Vehicle ID"
+// @Param   vehicle  body  models.UpdateVehicleRequest  true  "Fields to change"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Invalid request payload"
+// @Failure 409 {string} string "License plate already registered"
+// @Router /vehicles/{id} [patch]
+func (s *Server) UpdateVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorize(w, r, policy.UpdateVehicle, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var thisRequest models.UpdateVehicleRequest
+	err = json.Unmarshal(body, &thisRequest)
+	if err != nil {
+		respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var changes service.VehicleChanges
+	if thisRequest.Make != nil {
+		vehicleMake := strings.TrimSpace(*thisRequest.Make)
+		if vehicleMake == "" {
+			respondWithError(w, "Make can't be empty", http.StatusBadRequest)
+			return
+		}
+		changes.Make = &vehicleMake
+	}
+	if thisRequest.Model != nil {
+		model := strings.TrimSpace(*thisRequest.Model)
+		if model == "" {
+			respondWithError(w, "Model can't be empty", http.StatusBadRequest)
+			return
+		}
+		changes.Model = &model
+	}
+	changes.Year = thisRequest.Year
+	if thisRequest.LicensePlate != nil {
+		licensePlate := strings.TrimSpace(*thisRequest.LicensePlate)
+		if licensePlate == "" {
+			respondWithError(w, "License plate can't be empty", http.StatusBadRequest)
+			return
+		}
+		changes.LicensePlate = &licensePlate
+	}
+	if changes == (service.VehicleChanges{}) {
+		respondWithError(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Vehicles.Update(r.Context(), vehicleID, changes); err != nil {
+		respondWithServiceError(w, err, "Failed to update vehicle")
+		return
+	}
+
+	vehicle, err := s.Vehicles.Get(r.Context(), vehicleID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to retrieve vehicle")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Vehicle updated successfully",
+		"vehicle": vehicle,
+	})
+}
+
+// @Summary Delete a vehicle
+// @Description Removes the vehicle, releases its driver and shrinks the owner's fleet
+// @Security ApiKeyAuth
+// @Produce json
+// @Param   id  path  int  true  "Vehicle ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {string} string "Vehicle not found"
+// @Router /vehicles/{id} [delete]
+func (s *Server) DeleteVehicle(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	userDetails, ok := auth.GetUserDetailsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "User details not found in context. Authentication is required", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.authorize(w, r, policy.DeleteVehicle, policy.Vehicle(vehicleID)) {
+		return
+	}
+
+	if err := s.Vehicles.Delete(r.Context(), vehicleID, s.actorOf(userDetails)); err != nil {
+		respondWithServiceError(w, err, "Failed to delete vehicle")
+		return
+	}
+
+	log.Printf("User %d deleted vehicle %d", userDetails.UserID, vehicleID)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Vehicle deleted successfully"})
+}
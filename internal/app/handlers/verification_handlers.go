@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/mail"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+// @Summary Verify an email address
+// @Description Confirms the email address using the token sent after registration
+// @Produce json
+// @Param   token  query  string  true  "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {string} string "Invalid or expired token"
+// @Router /verify-email [get]
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, "Unaccepted method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	err := s.Users.VerifyEmail(r.Context(), token)
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		respondWithError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondWithError(w, "Failed to verify email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Email verified. You can now login"})
+}
+
+func (s *Server) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Users.Get(r.Context(), userID)
+	if err != nil {
+		respondWithServiceError(w, err, "Failed to send verification email")
+		return
+	}
+	if user.EmailVerified {
+		respondWithError(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), userID, user.Fullname, user.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+		respondWithError(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
+
+func (s *Server) ForceVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := parsePathID(r, "id")
+	if err != nil {
+		respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Users.MarkEmailVerified(r.Context(), userID); err != nil {
+		respondWithServiceError(w, err, "Failed to verify email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Email marked as verified"})
+}
+
+func (s *Server) sendVerificationEmail(ctx context.Context, userID int, fullname, email string) error {
+	token, err := s.Users.IssueVerificationToken(ctx, userID, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mail.Default.Send(ctx, verificationEmail(fullname, email, token))
+}
+
+func verificationEmail(fullname, email, token string) mail.Message {
+	return mail.Message{
+		To:      email,
+		Subject: "Verify your Fleet Management email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nConfirm your email address with the link below. It expires in %d hours.\n\n%s\n",
+			fullname, int(emailVerificationTTL.Hours()), linkWithToken("EMAIL_VERIFICATION_URL", "/verify-email", token),
+		),
+	}
+}
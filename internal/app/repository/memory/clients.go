@@ -0,0 +1,264 @@
+package memory
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+type apiKey struct {
+	id         int
+	userID     int
+	name       string
+	prefix     string
+	hash       string
+	scopes     []string
+	createdAt  time.Time
+	lastUsedAt time.Time
+	expiresAt  time.Time
+	revokedAt  time.Time
+}
+
+type oauthClient struct {
+	id         int
+	clientID   string
+	secretHash string
+	name       string
+	userID     int
+	scopes     []string
+	createdAt  time.Time
+	revokedAt  time.Time
+}
+
+// APIKeys follows the auth package. Like there, scopes that aren't
+// permissions are dropped.
+type APIKeys struct{ *Store }
+
+func (s APIKeys) Create(userID int, name string, scopes []string, expiresAt *time.Time) (int, string, string, error) {
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := &apiKey{
+		id:        s.id(),
+		userID:    userID,
+		name:      name,
+		prefix:    prefix,
+		hash:      auth.HashToken(key),
+		scopes:    s.knownPermissions(scopes),
+		createdAt: time.Now(),
+	}
+	if expiresAt != nil {
+		k.expiresAt = *expiresAt
+	}
+	s.apiKeys = append(s.apiKeys, k)
+	return k.id, prefix, key, nil
+}
+
+func (s APIKeys) List(userID int) ([]models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []models.APIKey{}
+	for i := len(s.apiKeys) - 1; i >= 0; i-- {
+		k := s.apiKeys[i]
+		if k.userID != userID {
+			continue
+		}
+		keys = append(keys, models.APIKey{
+			ID:         k.id,
+			Name:       k.name,
+			Prefix:     k.prefix,
+			Scopes:     append([]string{}, k.scopes...),
+			CreatedAt:  k.createdAt,
+			LastUsedAt: timePtr(k.lastUsedAt),
+			ExpiresAt:  timePtr(k.expiresAt),
+			RevokedAt:  timePtr(k.revokedAt),
+		})
+	}
+	return keys, nil
+}
+
+func (s APIKeys) Revoke(userID, keyID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.id == keyID && k.userID == userID {
+			if k.revokedAt.IsZero() {
+				k.revokedAt = time.Now()
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s APIKeys) RevokeAll(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.userID == userID && k.revokedAt.IsZero() {
+			k.revokedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s APIKeys) Validate(key string) (*auth.UserClaims, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := auth.HashToken(key)
+	for _, k := range s.apiKeys {
+		if k.hash != hash {
+			continue
+		}
+		now := time.Now()
+		if !k.revokedAt.IsZero() || (!k.expiresAt.IsZero() && now.After(k.expiresAt)) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		k.lastUsedAt = now
+		return &auth.UserClaims{
+			UserID:   k.userID,
+			Role:     s.users[k.userID].role,
+			APIKeyID: k.id,
+			Scopes:   append([]string{}, k.scopes...),
+		}, nil
+	}
+	return nil, auth.ErrInvalidAPIKey
+}
+
+type OAuthClients struct{ *Store }
+
+func (s OAuthClients) Create(name string, userID int, scopes []string) (int, string, string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return 0, "", "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	secret, err := auth.NewOpaqueToken(32)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &oauthClient{
+		id:         s.id(),
+		clientID:   "fmc_" + hex.EncodeToString(b),
+		secretHash: auth.HashToken(secret),
+		name:       name,
+		userID:     userID,
+		scopes:     s.knownPermissions(scopes),
+		createdAt:  time.Now(),
+	}
+	s.oauthClients = append(s.oauthClients, c)
+	return c.id, c.clientID, secret, nil
+}
+
+func (s OAuthClients) List() ([]models.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := []models.OAuthClient{}
+	for _, c := range s.oauthClients {
+		clients = append(clients, models.OAuthClient{
+			ID:        c.id,
+			ClientID:  c.clientID,
+			Name:      c.name,
+			UserID:    c.userID,
+			Scopes:    append([]string{}, c.scopes...),
+			CreatedAt: c.createdAt,
+			RevokedAt: timePtr(c.revokedAt),
+		})
+	}
+	return clients, nil
+}
+
+func (s OAuthClients) Revoke(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.oauthClients {
+		if c.id == id {
+			if c.revokedAt.IsZero() {
+				c.revokedAt = time.Now()
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s OAuthClients) Authenticate(clientID, secret string) (*auth.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.activeClient(clientID)
+	if !ok || subtle.ConstantTimeCompare([]byte(c.secretHash), []byte(auth.HashToken(secret))) != 1 {
+		return nil, auth.ErrInvalidClient
+	}
+	return &auth.OAuthClient{
+		ID:       c.id,
+		ClientID: c.clientID,
+		UserID:   c.userID,
+		Role:     s.users[c.userID].role,
+		Scopes:   append([]string{}, c.scopes...),
+	}, nil
+}
+
+func (s OAuthClients) Active(clientID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.activeClient(clientID)
+	return ok, nil
+}
+
+func (s *Store) activeClient(clientID string) (*oauthClient, bool) {
+	for _, c := range s.oauthClients {
+		if c.clientID == clientID && c.revokedAt.IsZero() {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// knownPermissions returns the names among scopes that are permissions,
+// sorted and without duplicates.
+func (s *Store) knownPermissions(scopes []string) []string {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	known := []string{}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if _, ok := s.permissions[scope]; ok && !seen[scope] {
+			seen[scope] = true
+			known = append(known, scope)
+		}
+	}
+	sort.Strings(known)
+	return known
+}
+
+func removeKeys(keys []*apiKey, userID int) []*apiKey {
+	kept := keys[:0]
+	for _, k := range keys {
+		if k.userID != userID {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+func removeClients(clients []*oauthClient, userID int) []*oauthClient {
+	kept := clients[:0]
+	for _, c := range clients {
+		if c.userID != userID {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
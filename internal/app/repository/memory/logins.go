@@ -0,0 +1,424 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+type session struct {
+	id         string
+	userID     int
+	userAgent  string
+	ip         string
+	createdAt  time.Time
+	lastSeenAt time.Time
+	expiresAt  time.Time
+	revokedAt  time.Time
+}
+
+type refreshToken struct {
+	sessionID string
+	expiresAt time.Time
+	used      bool
+}
+
+type mfaState struct {
+	secret        string
+	enabledAt     time.Time
+	lastUsedStep  int64
+	recoveryCodes map[string]bool // hash to whether it was used
+	createdAt     time.Time
+}
+
+type event struct {
+	auth.Event
+	createdAt time.Time
+}
+
+// Logins follows the auth package, errors included. Tokens are checked
+// against the store right away rather than against a cached copy.
+type Logins struct{ *Store }
+
+func (s Logins) LockedUntil(keys ...string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lockedUntil time.Time
+	for _, key := range keys {
+		if t := s.lockedUntil(key); t.After(lockedUntil) {
+			lockedUntil = t
+		}
+	}
+	return lockedUntil, nil
+}
+
+func (s Logins) RecordFailure(key string, throttle auth.Throttle) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recordFailure(key, throttle), nil
+}
+
+func (s Logins) ResetFailures(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.throttles, key)
+	return nil
+}
+
+func (s Logins) MFAStatus(userID int) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, false, fmt.Errorf("user %d not found", userID)
+	}
+	m, enrolled := s.mfa[userID]
+	s.permissionsMu.Lock()
+	r, ok := s.roles[u.role]
+	required := ok && r.mfaRequired
+	s.permissionsMu.Unlock()
+	return enrolled && !m.enabledAt.IsZero(), required, nil
+}
+
+func (s Logins) CreateSession(userID int, userAgent, ip string) (string, string, error) {
+	sessionID, err := auth.NewOpaqueToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := auth.NewOpaqueToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	expiresAt := now.Add(auth.RefreshTokenTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = &session{
+		id:         sessionID,
+		userID:     userID,
+		userAgent:  userAgent,
+		ip:         ip,
+		createdAt:  now,
+		lastSeenAt: now,
+		expiresAt:  expiresAt,
+	}
+	s.refreshTokens[auth.HashToken(token)] = &refreshToken{sessionID: sessionID, expiresAt: expiresAt}
+	return sessionID, token, nil
+}
+
+func (s Logins) RecordEvent(e auth.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordEvent(e)
+}
+
+func (s Logins) RotateRefreshToken(token string) (int, string, string, error) {
+	newToken, err := auth.NewOpaqueToken(32)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refreshTokens[auth.HashToken(token)]
+	if !ok {
+		return 0, "", "", auth.ErrInvalidRefreshToken
+	}
+	session := s.sessions[t.sessionID]
+	if t.used {
+		s.endSession(session)
+		return 0, "", "", auth.ErrRefreshTokenReused
+	}
+	now := time.Now()
+	if !session.revokedAt.IsZero() || now.After(t.expiresAt) {
+		return 0, "", "", auth.ErrInvalidRefreshToken
+	}
+
+	t.used = true
+	session.expiresAt = now.Add(auth.RefreshTokenTTL)
+	s.refreshTokens[auth.HashToken(newToken)] = &refreshToken{sessionID: session.id, expiresAt: session.expiresAt}
+	return session.userID, session.id, newToken, nil
+}
+
+func (s Logins) RevokeSessionByRefreshToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.refreshTokens[auth.HashToken(token)]; ok {
+		s.endSession(s.sessions[t.sessionID])
+	}
+	return nil
+}
+
+func (s Logins) Sessions(userID int) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, session := range s.sortedSessions() {
+		if session.userID != userID || !session.revokedAt.IsZero() || !now.Before(session.expiresAt) {
+			continue
+		}
+		sessions = append(sessions, models.Session{
+			ID:         session.id,
+			UserAgent:  session.userAgent,
+			IPAddress:  session.ip,
+			CreatedAt:  session.createdAt,
+			LastSeenAt: session.lastSeenAt,
+			ExpiresAt:  session.expiresAt,
+		})
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (s Logins) EndSession(userID int, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || session.userID != userID || !session.revokedAt.IsZero() {
+		return false, nil
+	}
+	s.endSession(session)
+	return true, nil
+}
+
+func (s Logins) RevokeUserSessions(userID int) error {
+	return s.RevokeOtherSessions(userID, "")
+}
+
+func (s Logins) RevokeOtherSessions(userID int, keep string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.userID == userID && session.id != keep {
+			s.endSession(session)
+		}
+	}
+	return nil
+}
+
+func (s Logins) RevokeToken(claims *auth.UserClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("token has no jti or expiry and cannot be revoked individually")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokedTokens[claims.ID] = claims.ExpiresAt.Time
+	return nil
+}
+
+func (s Logins) RevokeUser(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userCutoffs[userID] = time.Now().Truncate(time.Second)
+	return nil
+}
+
+func (s Logins) StartMFAEnrollment(userID int, account string) (*auth.MFAEnrollment, error) {
+	enrollment, err := auth.NewMFAEnrollment(account)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.mfa[userID]; ok && !m.enabledAt.IsZero() {
+		return nil, auth.ErrMFAAlreadyEnabled
+	}
+	m := &mfaState{
+		secret:        enrollment.Secret,
+		recoveryCodes: make(map[string]bool),
+		createdAt:     time.Now(),
+	}
+	for _, code := range enrollment.RecoveryCodes {
+		m.recoveryCodes[auth.HashRecoveryCode(code)] = false
+	}
+	s.mfa[userID] = m
+	return enrollment, nil
+}
+
+func (s Logins) ConfirmMFAEnrollment(userID int, code string) error {
+	return s.attemptMFA(userID, nil, func(m *mfaState) (bool, error) {
+		return confirmEnrollment(m, code)
+	})
+}
+
+func (s Logins) VerifyMFACode(userID int, code string) error {
+	return s.attemptMFA(userID, nil, func(m *mfaState) (bool, error) {
+		return verifyCode(m, code)
+	})
+}
+
+func (s Logins) CompleteMFAChallenge(challenge *auth.MFAChallengeClaims, code string) error {
+	return s.attemptMFA(challenge.UserID, challenge, func(m *mfaState) (bool, error) {
+		if challenge.Enroll {
+			return confirmEnrollment(m, code)
+		}
+		return verifyCode(m, code)
+	})
+}
+
+func (s Logins) DisableMFA(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mfa, userID)
+	return nil
+}
+
+func (s Logins) IsRevoked(claims *auth.UserClaims) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[claims.ID]; ok && claims.ID != "" {
+		return true, nil
+	}
+	if session, ok := s.sessions[claims.SessionID]; ok && !session.revokedAt.IsZero() {
+		return true, nil
+	}
+	userIDs := []int{claims.UserID}
+	if claims.Act != nil {
+		userIDs = append(userIDs, claims.Act.UserID)
+	}
+	for _, userID := range userIDs {
+		if cutoff, ok := s.userCutoffs[userID]; ok {
+			if claims.IssuedAt == nil || claims.IssuedAt.Before(cutoff) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s Logins) Touch(sessionID, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[sessionID]; ok {
+		session.lastSeenAt = time.Now()
+		session.ip = ip
+	}
+	return nil
+}
+
+// attemptMFA follows the auth package's attemptMFA, the store's lock
+// standing in for the user_mfa row lock.
+func (s *Store) attemptMFA(userID int, challenge *auth.MFAChallengeClaims, check func(m *mfaState) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mfa[userID]
+	if !ok {
+		return auth.ErrMFANotPending
+	}
+	key := auth.MFAKey(userID)
+	if lockedUntil := s.lockedUntil(key); !lockedUntil.IsZero() {
+		return &auth.MFALockedError{Until: lockedUntil}
+	}
+	if challenge != nil {
+		if _, used := s.revokedTokens[challenge.ID]; used {
+			return auth.ErrMFAChallengeUsed
+		}
+	}
+
+	ok, err := check(m)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if lockedUntil := s.recordFailure(key, auth.MFAThrottle); !lockedUntil.IsZero() {
+			s.recordEvent(auth.Event{
+				UserID:  userID,
+				Type:    auth.EventMFALocked,
+				Details: "locked until " + lockedUntil.Format(time.RFC3339),
+			})
+		}
+		return auth.ErrInvalidMFACode
+	}
+
+	if challenge != nil {
+		s.revokedTokens[challenge.ID] = challenge.ExpiresAt.Time
+	}
+	delete(s.throttles, key)
+	return nil
+}
+
+func confirmEnrollment(m *mfaState, code string) (bool, error) {
+	if !m.enabledAt.IsZero() {
+		return false, auth.ErrMFAAlreadyEnabled
+	}
+	step, ok := auth.MatchTOTP(m.secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	m.enabledAt = time.Now()
+	m.lastUsedStep = step
+	return true, nil
+}
+
+func verifyCode(m *mfaState, code string) (bool, error) {
+	if m.enabledAt.IsZero() {
+		return false, auth.ErrMFANotPending
+	}
+	if step, ok := auth.MatchTOTP(m.secret, code, time.Now()); ok && step > m.lastUsedStep {
+		m.lastUsedStep = step
+		return true, nil
+	}
+	hash := auth.HashRecoveryCode(code)
+	if used, ok := m.recoveryCodes[hash]; ok && !used {
+		m.recoveryCodes[hash] = true
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *Store) lockedUntil(key string) time.Time {
+	if t, ok := s.throttles[key]; ok && t.lockedUntil.After(time.Now()) {
+		return t.lockedUntil
+	}
+	return time.Time{}
+}
+
+func (s *Store) recordFailure(key string, throttle auth.Throttle) time.Time {
+	now := time.Now()
+	t, ok := s.throttles[key]
+	if !ok {
+		t = &failureCount{}
+		s.throttles[key] = t
+	}
+	if t.lastFailureAt.Before(now.Add(-throttle.ResetAfter)) {
+		t.failures = 0
+	}
+	t.failures++
+	t.lastFailureAt = now
+
+	delay := throttle.LockFor(t.failures)
+	if delay == 0 {
+		return time.Time{}
+	}
+	t.lockedUntil = now.Add(delay)
+	return t.lockedUntil
+}
+
+func (s *Store) recordEvent(e auth.Event) {
+	s.events = append(s.events, event{Event: e, createdAt: time.Now()})
+}
+
+func (s *Store) endSession(session *session) {
+	if session.revokedAt.IsZero() {
+		session.revokedAt = time.Now()
+	}
+}
+
+// sortedSessions returns the sessions oldest first.
+func (s *Store) sortedSessions() []*session {
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].createdAt.Before(sessions[j].createdAt) })
+	return sessions
+}
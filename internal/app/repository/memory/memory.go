@@ -0,0 +1,1314 @@
+// Package memory implements the repositories in memory for tests. A Store is
+// safe for concurrent use and starts empty: roles can't self-register and hold
+// no permissions until they are set up with AllowSelfRegistration and Grant.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+// The limits of the columns the Postgres schema enforces.
+const (
+	maxPlateLength   = 20
+	minVehicleYear   = 2005
+	maxLicenseLength = 50
+)
+
+type user struct {
+	id            int
+	name          string
+	email         string
+	passwordHash  string
+	role          string
+	emailVerified bool
+	deleted       bool
+}
+
+type driver struct {
+	licenseID string
+	assigned  bool
+}
+
+type vehicle struct {
+	id           int
+	make         string
+	model        string
+	year         int
+	licensePlate string
+	status       vehiclestatus.Status
+	ownerID      int
+	driverID     int
+}
+
+type assignment struct {
+	id           int
+	vehicleID    int // zero once the vehicle is deleted
+	licensePlate string
+	driverID     int
+	assignedBy   int
+	unassignedBy int
+	startedAt    time.Time
+	endedAt      time.Time
+}
+
+type transition struct {
+	id        int
+	vehicleID int
+	from      vehiclestatus.Status
+	to        vehiclestatus.Status
+	actorID   int
+	reason    string
+	createdAt time.Time
+}
+
+type oneTimeToken struct {
+	userID    int
+	purpose   string
+	expiresAt time.Time
+	used      bool
+}
+
+type failureCount struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+type Store struct {
+	mu     sync.Mutex
+	nextID int
+
+	users         map[int]*user
+	drivers       map[int]*driver
+	owners        map[int]int // user ID to fleet size
+	vehicles      map[int]*vehicle
+	assignments   []*assignment
+	transitions   []*transition
+	oneTimeTokens map[string]*oneTimeToken // by hash
+
+	// Roles and permissions have their own lock since they are checked while
+	// mu is held, as the row locks are held in Postgres. Whatever needs both
+	// takes mu first.
+	permissionsMu sync.Mutex
+	roles         map[string]*role
+	permissions   map[string]*permission
+
+	throttles     map[string]*failureCount
+	sessions      map[string]*session
+	refreshTokens map[string]*refreshToken // by hash
+	revokedTokens map[string]time.Time     // jti to expiry
+	userCutoffs   map[int]time.Time
+	mfa           map[int]*mfaState
+	events        []event
+
+	apiKeys      []*apiKey
+	oauthClients []*oauthClient
+}
+
+func New() *Store {
+	return &Store{
+		users:         make(map[int]*user),
+		drivers:       make(map[int]*driver),
+		owners:        make(map[int]int),
+		vehicles:      make(map[int]*vehicle),
+		oneTimeTokens: make(map[string]*oneTimeToken),
+		roles:         make(map[string]*role),
+		permissions:   make(map[string]*permission),
+		throttles:     make(map[string]*failureCount),
+		sessions:      make(map[string]*session),
+		refreshTokens: make(map[string]*refreshToken),
+		revokedTokens: make(map[string]time.Time),
+		userCutoffs:   make(map[int]time.Time),
+		mfa:           make(map[int]*mfaState),
+	}
+}
+
+func (s *Store) Repositories() repository.Repositories {
+	return repository.Repositories{
+		Users:        Users{s},
+		Drivers:      Drivers{s},
+		Owners:       Owners{s},
+		Vehicles:     Vehicles{s},
+		Permissions:  Permissions{s},
+		Roles:        Roles{s},
+		Logins:       Logins{s},
+		APIKeys:      APIKeys{s},
+		OAuthClients: OAuthClients{s},
+		Resources:    Resources{s},
+	}
+}
+
+// AllowSelfRegistration and Grant set up roles and permissions as the
+// migrations seed them, so they are system ones.
+
+func (s *Store) AllowSelfRegistration(roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	for _, name := range roles {
+		s.systemRole(name).selfRegistration = true
+	}
+}
+
+func (s *Store) Grant(role string, permissions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r := s.systemRole(role)
+	for _, name := range permissions {
+		p, ok := s.permissions[name]
+		if !ok {
+			p = &permission{id: s.id(), name: name, isSystem: true}
+			s.permissions[name] = p
+		}
+		r.permissions[p.name] = true
+	}
+}
+
+// AddUser creates a user with a verified email address and no driver or
+// owner profile, as an admin would be created.
+func (s *Store) AddUser(name, email, passwordHash, role string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.addUser(name, email, passwordHash, role)
+	if err != nil {
+		return 0, err
+	}
+	u.emailVerified = true
+	return u.id, nil
+}
+
+func (s *Store) VerifyEmail(userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.emailVerified = true
+	}
+}
+
+// Events returns the auth events recorded so far.
+func (s *Store) Events() []auth.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]auth.Event, 0, len(s.events))
+	for _, e := range s.events {
+		events = append(events, e.Event)
+	}
+	return events
+}
+
+func (s *Store) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Store) addUser(name, email, passwordHash, role string) (*user, error) {
+	for _, u := range s.users {
+		if u.email == email {
+			return nil, service.ErrEmailTaken
+		}
+	}
+	u := &user{id: s.id(), name: name, email: email, passwordHash: passwordHash, role: role}
+	s.users[u.id] = u
+	return u, nil
+}
+
+func (s *Store) sortedVehicles() []*vehicle {
+	vehicles := make([]*vehicle, 0, len(s.vehicles))
+	for _, v := range s.vehicles {
+		vehicles = append(vehicles, v)
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].id < vehicles[j].id })
+	return vehicles
+}
+
+func (s *Store) userName(id int) (sql.NullString, sql.NullString) {
+	u, ok := s.users[id]
+	if !ok {
+		return sql.NullString{}, sql.NullString{}
+	}
+	return sql.NullString{String: u.name, Valid: true}, sql.NullString{String: u.email, Valid: true}
+}
+
+// page returns the bounds of page within n rows.
+func page(p repository.Page, n int) (int, int) {
+	start := p.Offset()
+	if start > n {
+		start = n
+	}
+	end := start + p.Limit
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+type Users struct{ *Store }
+
+func (s Users) Register(ctx context.Context, newUser service.NewUser) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	r, ok := s.roles[newUser.Role]
+	selfRegistration := ok && r.selfRegistration
+	s.permissionsMu.Unlock()
+	if !selfRegistration {
+		return 0, service.ErrRoleNotAllowed
+	}
+	if newUser.Role == "driver" {
+		if err := s.checkLicense(0, newUser.LicenseID); err != nil {
+			return 0, err
+		}
+	}
+
+	u, err := s.addUser(newUser.Name, newUser.Email, newUser.PasswordHash, newUser.Role)
+	if err != nil {
+		return 0, err
+	}
+	switch newUser.Role {
+	case "driver":
+		s.drivers[u.id] = &driver{licenseID: newUser.LicenseID}
+	case "vehicle_owner":
+		s.owners[u.id] = 0
+	}
+	return u.id, nil
+}
+
+func (s Users) Credentials(ctx context.Context, email string) (repository.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.email == email {
+			return repository.Credentials{
+				UserID:        u.id,
+				PasswordHash:  u.passwordHash,
+				Role:          u.role,
+				EmailVerified: u.emailVerified,
+			}, nil
+		}
+	}
+	return repository.Credentials{}, repository.ErrNotFound
+}
+
+func (s Users) Get(ctx context.Context, userID int) (repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.user(userID)
+	if err != nil {
+		return repository.User{}, err
+	}
+	return repository.User{
+		ID:            u.id,
+		Fullname:      u.name,
+		Email:         u.email,
+		Role:          u.role,
+		PasswordHash:  u.passwordHash,
+		EmailVerified: u.emailVerified,
+	}, nil
+}
+
+func (s Users) Profile(ctx context.Context, userID int) (*models.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.Profile{
+		ID:            u.id,
+		Fullname:      u.name,
+		Email:         u.email,
+		Role:          u.role,
+		EmailVerified: u.emailVerified,
+	}
+	if d, ok := s.drivers[userID]; ok {
+		profile.Driver = &models.DriverProfile{LicenseID: d.licenseID, Assigned: d.assigned}
+		for _, v := range s.vehicles {
+			if v.driverID == userID {
+				profile.Driver.Vehicle = &models.AssignedVehicle{
+					ID:           v.id,
+					Make:         v.make,
+					Model:        v.model,
+					Year:         v.year,
+					LicensePlate: v.licensePlate,
+					Status:       string(v.status),
+				}
+			}
+		}
+	}
+	if fleetSize, ok := s.owners[userID]; ok {
+		profile.Owner = &models.OwnerProfile{FleetSize: fleetSize}
+	}
+	return profile, nil
+}
+
+func (s Users) UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok && u.passwordHash == oldHash {
+		u.passwordHash = newHash
+	}
+	return nil
+}
+
+// UpdateProfile follows service.UpdateProfile.
+func (s Users) UpdateProfile(ctx context.Context, userID int, currentHash string, changes service.ProfileChanges) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.account(userID, currentHash)
+	if err != nil {
+		return err
+	}
+
+	if changes.Email != nil {
+		for _, other := range s.users {
+			if other.id != userID && other.email == *changes.Email {
+				return service.ErrEmailTaken
+			}
+		}
+	}
+	d, isDriver := s.drivers[userID]
+	if changes.LicenseID != nil && isDriver {
+		if err := s.checkLicense(userID, *changes.LicenseID); err != nil {
+			return err
+		}
+	}
+
+	if changes.Fullname != nil {
+		u.name = *changes.Fullname
+	}
+	if changes.Email != nil {
+		u.email = *changes.Email
+		u.emailVerified = false
+	}
+	if changes.LicenseID != nil && isDriver {
+		d.licenseID = *changes.LicenseID
+	}
+	if changes.PasswordHash != nil {
+		u.passwordHash = *changes.PasswordHash
+	}
+	return nil
+}
+
+// Delete follows service.DeleteAccount.
+func (s Users) Delete(ctx context.Context, userID int, currentHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.account(userID, currentHash)
+	if err != nil {
+		return err
+	}
+	for _, v := range s.vehicles {
+		if v.ownerID == userID {
+			return service.ErrVehiclesRegistered
+		}
+	}
+
+	s.removeDriver(userID)
+	delete(s.owners, userID)
+	for hash, t := range s.oneTimeTokens {
+		if t.userID == userID {
+			delete(s.oneTimeTokens, hash)
+		}
+	}
+	delete(s.mfa, userID)
+	s.apiKeys = removeKeys(s.apiKeys, userID)
+	s.oauthClients = removeClients(s.oauthClients, userID)
+	for i := range s.events {
+		if e := &s.events[i]; e.UserID == userID {
+			e.Email, e.IP, e.Details = "", "", ""
+		}
+	}
+
+	u.name = "Deleted user"
+	u.email = fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+	u.passwordHash = "!"
+	u.emailVerified = false
+	u.deleted = true
+
+	// The account is only gone once its tokens stop working
+	for _, session := range s.sessions {
+		if session.userID == userID {
+			session.userAgent, session.ip = "", ""
+			s.endSession(session)
+		}
+	}
+	s.userCutoffs[userID] = time.Now().Truncate(time.Second)
+	return nil
+}
+
+// removeDriver does what deleting a drivers row does in the database: the
+// driver's vehicle is released and, if it was in use, made available by the
+// release_vehicle_without_driver trigger.
+func (s *Store) removeDriver(userID int) {
+	if _, ok := s.drivers[userID]; !ok {
+		return
+	}
+	for _, v := range s.vehicles {
+		if v.driverID != userID {
+			continue
+		}
+		s.endAssignment(v.id, 0)
+		v.driverID = 0
+		if v.status == vehiclestatus.InUse {
+			s.changeStatus(v, vehiclestatus.Available, 0, "Driver removed")
+		}
+	}
+	delete(s.drivers, userID)
+}
+
+// SetRole follows service.SetUserRole.
+func (s Users) SetRole(ctx context.Context, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return service.ErrUserNotFound
+	}
+	s.permissionsMu.Lock()
+	_, exists := s.roles[role]
+	s.permissionsMu.Unlock()
+	if !exists {
+		return service.ErrRoleNotFound
+	}
+
+	if u.role == role {
+		return service.ErrSameRole
+	}
+	if profileRoles[u.role] || profileRoles[role] {
+		return service.ErrProfileRole
+	}
+	if u.role == "super_admin" {
+		otherAdmins := 0
+		for _, other := range s.users {
+			if other.id != userID && other.role == "super_admin" {
+				otherAdmins++
+			}
+		}
+		if otherAdmins == 0 {
+			return service.ErrLastAdmin
+		}
+	}
+	u.role = role
+	return nil
+}
+
+func (s Users) IssueVerificationToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return s.issueToken(userID, auth.PurposeEmailVerification, ttl)
+}
+
+func (s Users) VerifyEmail(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.oneTimeToken(token, auth.PurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+	t.used = true
+	if u, ok := s.users[t.userID]; ok {
+		u.emailVerified = true
+	}
+	return nil
+}
+
+func (s Users) MarkEmailVerified(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.user(userID)
+	if err != nil {
+		return err
+	}
+	u.emailVerified = true
+	return nil
+}
+
+func (s Users) IssuePasswordResetToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return s.issueToken(userID, auth.PurposePasswordReset, ttl)
+}
+
+// ResetPassword follows service.ResetPassword. The token is only used up
+// once newHash succeeds, as the transaction would be rolled back otherwise.
+func (s Users) ResetPassword(ctx context.Context, token string, newHash func(fullname, email string) (string, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.oneTimeToken(token, auth.PurposePasswordReset)
+	if err != nil {
+		return 0, err
+	}
+	u, ok := s.users[t.userID]
+	if !ok {
+		return 0, service.ErrUserNotFound
+	}
+	passwordHash, err := newHash(u.name, u.email)
+	if err != nil {
+		return 0, err
+	}
+
+	t.used = true
+	u.passwordHash = passwordHash
+	for _, session := range s.sessions {
+		if session.userID == u.id {
+			s.endSession(session)
+		}
+	}
+	s.userCutoffs[u.id] = time.Now().Truncate(time.Second)
+	return u.id, nil
+}
+
+// Export writes the same sections and columns as the database does, NULL
+// being nil. The records are collected first so that the writer isn't
+// called with the store locked.
+func (s Users) Export(ctx context.Context, userID int, w repository.ExportWriter) error {
+	for _, section := range s.exportSections(userID) {
+		if err := w.Section(section.name); err != nil {
+			return err
+		}
+		for _, record := range section.records {
+			if err := w.Record(record); err != nil {
+				return err
+			}
+		}
+		if err := w.EndSection(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type exportSection struct {
+	name    string
+	records []map[string]interface{}
+}
+
+func (s *Store) exportSections(userID int) []exportSection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vehicles := exportSection{name: "vehicles_owned"}
+	for _, v := range s.sortedVehicles() {
+		if v.ownerID == userID {
+			vehicles.records = append(vehicles.records, map[string]interface{}{
+				"id":            v.id,
+				"make":          v.make,
+				"model":         v.model,
+				"year":          v.year,
+				"license_plate": v.licensePlate,
+				"status":        string(v.status),
+				"driver_id":     nullInt(v.driverID),
+			})
+		}
+	}
+
+	assignments := exportSection{name: "vehicle_assignments"}
+	for _, a := range s.assignments {
+		if a.driverID == userID {
+			assignments.records = append(assignments.records, map[string]interface{}{
+				"vehicle_id":    nullInt(a.vehicleID),
+				"license_plate": a.licensePlate,
+				"started_at":    a.startedAt,
+				"ended_at":      nullTime(a.endedAt),
+			})
+		}
+	}
+
+	sessions := exportSection{name: "sessions"}
+	for _, session := range s.sortedSessions() {
+		if session.userID == userID {
+			sessions.records = append(sessions.records, map[string]interface{}{
+				"id":           session.id,
+				"user_agent":   nullString(session.userAgent),
+				"ip_address":   nullString(session.ip),
+				"created_at":   session.createdAt,
+				"last_seen_at": session.lastSeenAt,
+				"expires_at":   session.expiresAt,
+				"revoked_at":   nullTime(session.revokedAt),
+			})
+		}
+	}
+
+	keys := exportSection{name: "api_keys"}
+	for _, k := range s.apiKeys {
+		if k.userID == userID {
+			keys.records = append(keys.records, map[string]interface{}{
+				"id":           k.id,
+				"name":         k.name,
+				"prefix":       k.prefix,
+				"created_at":   k.createdAt,
+				"last_used_at": nullTime(k.lastUsedAt),
+				"expires_at":   nullTime(k.expiresAt),
+				"revoked_at":   nullTime(k.revokedAt),
+			})
+		}
+	}
+
+	clients := exportSection{name: "oauth_clients"}
+	for _, c := range s.oauthClients {
+		if c.userID == userID {
+			clients.records = append(clients.records, map[string]interface{}{
+				"id":         c.id,
+				"client_id":  c.clientID,
+				"name":       c.name,
+				"created_at": c.createdAt,
+				"revoked_at": nullTime(c.revokedAt),
+			})
+		}
+	}
+
+	mfa := exportSection{name: "mfa"}
+	if m, ok := s.mfa[userID]; ok {
+		mfa.records = append(mfa.records, map[string]interface{}{
+			"created_at": m.createdAt,
+			"enabled_at": nullTime(m.enabledAt),
+		})
+	}
+
+	events := exportSection{name: "auth_events"}
+	for _, e := range s.events {
+		if e.UserID == userID {
+			events.records = append(events.records, map[string]interface{}{
+				"event_type": e.Type,
+				"email":      nullString(e.Email),
+				"ip_address": nullString(e.IP),
+				"details":    nullString(e.Details),
+				"created_at": e.createdAt,
+			})
+		}
+	}
+
+	return []exportSection{vehicles, assignments, sessions, keys, clients, mfa, events}
+}
+
+// profileRoles are those of service.SetUserRole.
+var profileRoles = map[string]bool{"driver": true, "vehicle_owner": true}
+
+// user returns a user who hasn't been deleted.
+func (s *Store) user(userID int) (*user, error) {
+	u, ok := s.users[userID]
+	if !ok || u.deleted {
+		return nil, service.ErrUserNotFound
+	}
+	return u, nil
+}
+
+// account returns a user who hasn't been deleted and whose password hash is
+// still currentHash, as service.lockAccount checks.
+func (s *Store) account(userID int, currentHash string) (*user, error) {
+	u, err := s.user(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.passwordHash != currentHash {
+		return nil, service.ErrPasswordChanged
+	}
+	return u, nil
+}
+
+// checkLicense checks a license ID for the driver userID, zero for a new
+// one.
+func (s *Store) checkLicense(userID int, licenseID string) error {
+	if utf8.RuneCountInString(licenseID) > maxLicenseLength {
+		return service.ErrValueTooLong
+	}
+	for id, d := range s.drivers {
+		if id != userID && d.licenseID == licenseID {
+			return service.ErrLicenseTaken
+		}
+	}
+	return nil
+}
+
+// issueToken follows auth.IssueOneTimeToken.
+func (s *Store) issueToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.NewOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.oneTimeTokens {
+		if t.userID == userID && t.purpose == purpose {
+			t.used = true
+		}
+	}
+	s.oneTimeTokens[auth.HashToken(token)] = &oneTimeToken{
+		userID:    userID,
+		purpose:   purpose,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return token, nil
+}
+
+// oneTimeToken returns token if it can still be consumed for purpose.
+func (s *Store) oneTimeToken(token, purpose string) (*oneTimeToken, error) {
+	t, ok := s.oneTimeTokens[auth.HashToken(token)]
+	if !ok || t.purpose != purpose || t.used || !time.Now().Before(t.expiresAt) {
+		return nil, auth.ErrInvalidOneTimeToken
+	}
+	return t, nil
+}
+
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func intPtr(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type Drivers struct{ *Store }
+
+func (s Drivers) List(ctx context.Context, p repository.Page) ([]models.Driver, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.drivers))
+	for id := range s.drivers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	start, end := page(p, len(ids))
+	var drivers []models.Driver
+	for _, id := range ids[start:end] {
+		u, d := s.users[id], s.drivers[id]
+		thisDriver := models.Driver{
+			UserID:    id,
+			Fullname:  u.name,
+			Email:     u.email,
+			LicenseID: d.licenseID,
+			Assigned:  d.assigned,
+		}
+		for _, v := range s.vehicles {
+			if v.driverID == id {
+				thisDriver.VehicleMake = sql.NullString{String: v.make, Valid: true}
+				thisDriver.VehicleModel = sql.NullString{String: v.model, Valid: true}
+				thisDriver.VehicleYear = sql.NullInt64{Int64: int64(v.year), Valid: true}
+				thisDriver.VehicleLicensePlate = sql.NullString{String: v.licensePlate, Valid: true}
+			}
+		}
+		drivers = append(drivers, thisDriver)
+	}
+	return drivers, len(ids), nil
+}
+
+func (s Drivers) Assignments(ctx context.Context, driverID int, at time.Time) ([]models.VehicleAssignment, error) {
+	return s.listAssignments(func(a *assignment) bool { return a.driverID == driverID }, at), nil
+}
+
+type Owners struct{ *Store }
+
+func (s Owners) List(ctx context.Context, p repository.Page) ([]models.VehicleOwner, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.owners))
+	for id := range s.owners {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	start, end := page(p, len(ids))
+	var owners []models.VehicleOwner
+	for _, id := range ids[start:end] {
+		u := s.users[id]
+		owners = append(owners, models.VehicleOwner{
+			UserID:    id,
+			Fullname:  u.name,
+			Email:     u.email,
+			FleetSize: s.owners[id],
+		})
+	}
+	return owners, len(ids), nil
+}
+
+type Vehicles struct{ *Store }
+
+func (s Vehicles) Add(ctx context.Context, ownerID int, newVehicle service.NewVehicle) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.owners[ownerID]; !ok {
+		return 0, service.ErrOwnerNotFound
+	}
+	if utf8.RuneCountInString(newVehicle.LicensePlate) > maxPlateLength {
+		return 0, service.ErrValueTooLong
+	}
+	if newVehicle.Year < minVehicleYear {
+		return 0, service.ErrInvalidVehicle
+	}
+	for _, v := range s.vehicles {
+		if v.licensePlate == newVehicle.LicensePlate {
+			return 0, service.ErrPlateTaken
+		}
+	}
+
+	v := &vehicle{
+		id:           s.id(),
+		make:         newVehicle.Make,
+		model:        newVehicle.Model,
+		year:         newVehicle.Year,
+		licensePlate: newVehicle.LicensePlate,
+		status:       vehiclestatus.Available,
+		ownerID:      ownerID,
+	}
+	s.vehicles[v.id] = v
+	s.owners[ownerID]++
+	return v.id, nil
+}
+
+func (s Vehicles) Get(ctx context.Context, vehicleID int) (models.Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return models.Vehicle{}, service.ErrVehicleNotFound
+	}
+	thisVehicle := s.model(v)
+	thisVehicle.OwnerName, thisVehicle.OwnerEmail = s.userName(v.ownerID)
+	return thisVehicle, nil
+}
+
+func (s Vehicles) List(ctx context.Context, p repository.Page) ([]models.Vehicle, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.sortedVehicles()
+	start, end := page(p, len(all))
+	var vehicles []models.Vehicle
+	for _, v := range all[start:end] {
+		thisVehicle := s.model(v)
+		thisVehicle.OwnerName, thisVehicle.OwnerEmail = s.userName(v.ownerID)
+		vehicles = append(vehicles, thisVehicle)
+	}
+	return vehicles, len(all), nil
+}
+
+func (s Vehicles) ListByOwner(ctx context.Context, ownerID int, p repository.Page) ([]models.Vehicle, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fleetSize, ok := s.owners[ownerID]
+	if !ok {
+		return nil, 0, service.ErrOwnerNotFound
+	}
+
+	var owned []*vehicle
+	for _, v := range s.sortedVehicles() {
+		if v.ownerID == ownerID {
+			owned = append(owned, v)
+		}
+	}
+	start, end := page(p, len(owned))
+	var vehicles []models.Vehicle
+	for _, v := range owned[start:end] {
+		vehicles = append(vehicles, s.model(v))
+	}
+	return vehicles, fleetSize, nil
+}
+
+func (s Vehicles) Update(ctx context.Context, vehicleID int, changes service.VehicleChanges) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return service.ErrVehicleNotFound
+	}
+	if changes.LicensePlate != nil {
+		if utf8.RuneCountInString(*changes.LicensePlate) > maxPlateLength {
+			return service.ErrValueTooLong
+		}
+		for _, other := range s.vehicles {
+			if other.id != vehicleID && other.licensePlate == *changes.LicensePlate {
+				return service.ErrPlateTaken
+			}
+		}
+	}
+	if changes.Year != nil && *changes.Year < minVehicleYear {
+		return service.ErrInvalidVehicle
+	}
+
+	if changes.Make != nil {
+		v.make = *changes.Make
+	}
+	if changes.Model != nil {
+		v.model = *changes.Model
+	}
+	if changes.Year != nil {
+		v.year = *changes.Year
+	}
+	if changes.LicensePlate != nil {
+		v.licensePlate = *changes.LicensePlate
+	}
+	return nil
+}
+
+// Delete follows service.DeleteVehicle. Like the database, the store drops
+// the vehicle's status history and keeps its assignments.
+func (s Vehicles) Delete(ctx context.Context, vehicleID int, actor service.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return service.ErrVehicleNotFound
+	}
+	s.endAssignment(vehicleID, actor.UserID)
+	for _, a := range s.assignments {
+		if a.vehicleID == vehicleID {
+			a.vehicleID = 0
+		}
+	}
+	transitions := s.transitions[:0]
+	for _, t := range s.transitions {
+		if t.vehicleID != vehicleID {
+			transitions = append(transitions, t)
+		}
+	}
+	s.transitions = transitions
+
+	if d, ok := s.drivers[v.driverID]; ok {
+		d.assigned = false
+	}
+	if s.owners[v.ownerID] > 0 {
+		s.owners[v.ownerID]--
+	}
+	delete(s.vehicles, vehicleID)
+	return nil
+}
+
+func (s Vehicles) model(v *vehicle) models.Vehicle {
+	thisVehicle := models.Vehicle{
+		ID:           v.id,
+		Make:         v.make,
+		Model:        v.model,
+		Year:         v.year,
+		LicensePlate: v.licensePlate,
+		Status:       string(v.status),
+	}
+	if v.driverID != 0 {
+		thisVehicle.DriverName, thisVehicle.DriverEmail = s.userName(v.driverID)
+	}
+	return thisVehicle
+}
+
+// AssignDriver follows service.AssignDriver, the store's lock standing in
+// for the row locks.
+func (s Vehicles) AssignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return service.ErrVehicleNotFound
+	}
+	if v.status != vehiclestatus.Available || v.driverID != 0 {
+		return service.ErrVehicleUnavailable
+	}
+	next := vehiclestatus.Vehicle{Status: v.status, HasDriver: true}
+	if err := vehiclestatus.Default.Check(next, vehiclestatus.InUse, actor.HasPermission); err != nil {
+		return err
+	}
+
+	d, ok := s.drivers[driverID]
+	if !ok {
+		return service.ErrDriverNotFound
+	}
+	if d.assigned {
+		return service.ErrDriverAssigned
+	}
+
+	v.driverID = driverID
+	s.changeStatus(v, vehiclestatus.InUse, actor.UserID, "Driver "+strconv.Itoa(driverID)+" assigned")
+	d.assigned = true
+	s.startAssignment(v, driverID, actor.UserID)
+	return nil
+}
+
+// UnassignDriver follows service.UnassignDriver.
+func (s Vehicles) UnassignDriver(ctx context.Context, vehicleID int, actor service.Actor) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return 0, service.ErrVehicleNotFound
+	}
+	if v.driverID == 0 {
+		return 0, service.ErrNoDriver
+	}
+	driverID := v.driverID
+
+	if v.status == vehiclestatus.InUse {
+		next := vehiclestatus.Vehicle{Status: v.status}
+		if err := vehiclestatus.Default.Check(next, vehiclestatus.Available, actor.HasPermission); err != nil {
+			return driverID, err
+		}
+		s.changeStatus(v, vehiclestatus.Available, actor.UserID, "Driver "+strconv.Itoa(driverID)+" unassigned")
+	}
+
+	s.endAssignment(vehicleID, actor.UserID)
+	v.driverID = 0
+	if d, ok := s.drivers[driverID]; ok {
+		d.assigned = false
+	}
+	return driverID, nil
+}
+
+// ReassignDriver follows service.ReassignDriver.
+func (s Vehicles) ReassignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return 0, service.ErrVehicleNotFound
+	}
+	if v.driverID == 0 {
+		return 0, service.ErrNoDriver
+	}
+	previousID := v.driverID
+	if previousID == driverID {
+		return previousID, service.ErrSameDriver
+	}
+
+	d, ok := s.drivers[driverID]
+	if !ok {
+		return previousID, service.ErrDriverNotFound
+	}
+	if d.assigned {
+		return previousID, service.ErrDriverAssigned
+	}
+
+	s.endAssignment(vehicleID, actor.UserID)
+	v.driverID = driverID
+	if previous, ok := s.drivers[previousID]; ok {
+		previous.assigned = false
+	}
+	d.assigned = true
+	s.startAssignment(v, driverID, actor.UserID)
+	return previousID, nil
+}
+
+// ChangeStatus follows service.ChangeVehicleStatus.
+func (s Vehicles) ChangeStatus(
+	ctx context.Context,
+	vehicleID int,
+	to vehiclestatus.Status,
+	reason string,
+	actor service.Actor,
+) (vehiclestatus.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vehicles[vehicleID]
+	if !ok {
+		return "", service.ErrVehicleNotFound
+	}
+	from := v.status
+	if to == from {
+		return from, service.ErrSameStatus
+	}
+	current := vehiclestatus.Vehicle{Status: from, HasDriver: v.driverID != 0}
+	if err := vehiclestatus.Default.Check(current, to, actor.HasPermission); err != nil {
+		return from, err
+	}
+	s.changeStatus(v, to, actor.UserID, reason)
+	return from, nil
+}
+
+func (s Vehicles) StatusHistory(ctx context.Context, vehicleID int) ([]models.VehicleStatusTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transitions := []models.VehicleStatusTransition{}
+	for _, t := range s.transitions {
+		if t.vehicleID != vehicleID {
+			continue
+		}
+		transition := models.VehicleStatusTransition{
+			ID:         t.id,
+			FromStatus: string(t.from),
+			ToStatus:   string(t.to),
+			CreatedAt:  t.createdAt,
+		}
+		if u, ok := s.users[t.actorID]; ok {
+			transition.ActorID = intPtr(t.actorID)
+			name := u.name
+			transition.ActorName = &name
+		}
+		if t.reason != "" {
+			reason := t.reason
+			transition.Reason = &reason
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, nil
+}
+
+func (s Vehicles) Assignments(ctx context.Context, vehicleID int, at time.Time) ([]models.VehicleAssignment, error) {
+	return s.listAssignments(func(a *assignment) bool { return a.vehicleID == vehicleID }, at), nil
+}
+
+// changeStatus moves v to status to and records the transition, as
+// service.changeStatus does. actorID is zero for changes the database makes.
+func (s *Store) changeStatus(v *vehicle, to vehiclestatus.Status, actorID int, reason string) {
+	s.transitions = append(s.transitions, &transition{
+		id:        s.id(),
+		vehicleID: v.id,
+		from:      v.status,
+		to:        to,
+		actorID:   actorID,
+		reason:    reason,
+		createdAt: time.Now(),
+	})
+	v.status = to
+}
+
+func (s *Store) startAssignment(v *vehicle, driverID, actorID int) {
+	s.assignments = append(s.assignments, &assignment{
+		id:           s.id(),
+		vehicleID:    v.id,
+		licensePlate: v.licensePlate,
+		driverID:     driverID,
+		assignedBy:   actorID,
+		startedAt:    time.Now(),
+	})
+}
+
+func (s *Store) endAssignment(vehicleID, actorID int) {
+	for _, a := range s.assignments {
+		if a.vehicleID == vehicleID && a.endedAt.IsZero() {
+			a.endedAt = time.Now()
+			a.unassignedBy = actorID
+		}
+	}
+}
+
+// listAssignments lists the assignments match accepts newest first. With a
+// non-zero at, only those running at that time.
+func (s *Store) listAssignments(match func(a *assignment) bool, at time.Time) []models.VehicleAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assignments := []models.VehicleAssignment{}
+	for i := len(s.assignments) - 1; i >= 0; i-- {
+		a := s.assignments[i]
+		if !match(a) {
+			continue
+		}
+		if !at.IsZero() && (a.startedAt.After(at) || (!a.endedAt.IsZero() && !a.endedAt.After(at))) {
+			continue
+		}
+		driverName, _ := s.userName(a.driverID)
+		assignments = append(assignments, models.VehicleAssignment{
+			ID:           a.id,
+			VehicleID:    intPtr(a.vehicleID),
+			LicensePlate: a.licensePlate,
+			DriverID:     a.driverID,
+			DriverName:   driverName.String,
+			AssignedBy:   intPtr(a.assignedBy),
+			UnassignedBy: intPtr(a.unassignedBy),
+			StartedAt:    a.startedAt,
+			EndedAt:      timePtr(a.endedAt),
+		})
+	}
+	return assignments
+}
+
+type Permissions struct{ *Store }
+
+func (s Permissions) HasPermission(role, permission string) (bool, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r, ok := s.roles[role]
+	return ok && r.permissions[permission], nil
+}
+
+func (s Permissions) RolePermissions(role string) ([]string, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	var permissions []string
+	if r, ok := s.roles[role]; ok {
+		for permission := range r.permissions {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+type Resources struct{ *Store }
+
+func (s Resources) LoadVehicle(ctx context.Context, id int) (policy.Facts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.vehicles[id]
+	if !ok {
+		return policy.Facts{}, policy.ErrNotFound
+	}
+	return policy.Facts{OwnerID: v.ownerID, DriverID: v.driverID}, nil
+}
+
+func (s Resources) LoadDriver(ctx context.Context, userID int) (policy.Facts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.drivers[userID]; !ok {
+		return policy.Facts{}, policy.ErrNotFound
+	}
+	return policy.Facts{DriverID: userID}, nil
+}
+
+func (s Resources) LoadOwner(ctx context.Context, userID int) (policy.Facts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.owners[userID]; !ok {
+		return policy.Facts{}, policy.ErrNotFound
+	}
+	return policy.Facts{OwnerID: userID}, nil
+}
@@ -0,0 +1,209 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+type role struct {
+	id               int
+	name             string
+	isSystem         bool
+	selfRegistration bool
+	mfaRequired      bool
+	permissions      map[string]bool
+}
+
+type permission struct {
+	id       int
+	name     string
+	isSystem bool
+}
+
+type Roles struct{ *Store }
+
+func (s Roles) List(ctx context.Context) ([]models.Role, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	roles := []models.Role{}
+	for _, r := range s.roles {
+		thisRole := models.Role{
+			ID:               r.id,
+			Name:             r.name,
+			IsSystem:         r.isSystem,
+			SelfRegistration: r.selfRegistration,
+			MFARequired:      r.mfaRequired,
+			Permissions:      []string{},
+		}
+		for name := range r.permissions {
+			thisRole.Permissions = append(thisRole.Permissions, name)
+		}
+		sort.Strings(thisRole.Permissions)
+		roles = append(roles, thisRole)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (s Roles) Create(ctx context.Context, name string, selfRegistration bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	if _, ok := s.roles[name]; ok {
+		return 0, repository.ErrExists
+	}
+	r := &role{id: s.id(), name: name, selfRegistration: selfRegistration, permissions: make(map[string]bool)}
+	s.roles[name] = r
+	return r.id, nil
+}
+
+func (s Roles) Delete(ctx context.Context, roleID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r, ok := s.roleByID(roleID)
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if r.isSystem {
+		return repository.ErrSystem
+	}
+	for _, u := range s.users {
+		if u.role == r.name {
+			return repository.ErrInUse
+		}
+	}
+	delete(s.roles, r.name)
+	return nil
+}
+
+func (s Roles) SetMFARequired(ctx context.Context, roleID int, required bool) error {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r, ok := s.roleByID(roleID)
+	if !ok {
+		return repository.ErrNotFound
+	}
+	r.mfaRequired = required
+	return nil
+}
+
+func (s Roles) Name(ctx context.Context, roleID int) (string, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r, ok := s.roleByID(roleID)
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return r.name, nil
+}
+
+func (s Roles) Permissions(ctx context.Context) ([]models.Permission, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	permissions := []models.Permission{}
+	for _, p := range s.permissions {
+		permissions = append(permissions, models.Permission{ID: p.id, Name: p.name, IsSystem: p.isSystem})
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return permissions, nil
+}
+
+func (s Roles) CreatePermission(ctx context.Context, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	if _, ok := s.permissions[name]; ok {
+		return 0, repository.ErrExists
+	}
+	p := &permission{id: s.id(), name: name}
+	s.permissions[name] = p
+	return p.id, nil
+}
+
+// DeletePermission takes the permission from the roles holding it, but not
+// from the scopes of API keys and clients, which can't use it anymore
+// anyway.
+func (s Roles) DeletePermission(ctx context.Context, permissionID int) error {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	p, ok := s.permissionByID(permissionID)
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if p.isSystem {
+		return repository.ErrSystem
+	}
+	for _, r := range s.roles {
+		delete(r.permissions, p.name)
+	}
+	delete(s.permissions, p.name)
+	return nil
+}
+
+func (s Roles) PermissionName(ctx context.Context, permissionID int) (string, error) {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	p, ok := s.permissionByID(permissionID)
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return p.name, nil
+}
+
+// Grant and Revoke ignore roles and permissions that don't exist, as the
+// database does.
+
+func (s Roles) Grant(ctx context.Context, roleName, permissionName string) error {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	r, ok := s.roles[roleName]
+	if _, exists := s.permissions[permissionName]; ok && exists {
+		r.permissions[permissionName] = true
+	}
+	return nil
+}
+
+func (s Roles) Revoke(ctx context.Context, roleName, permissionName string) error {
+	s.permissionsMu.Lock()
+	defer s.permissionsMu.Unlock()
+	if r, ok := s.roles[roleName]; ok {
+		delete(r.permissions, permissionName)
+	}
+	return nil
+}
+
+// systemRole returns the role name, creating it as a system role if it
+// doesn't exist yet.
+func (s *Store) systemRole(name string) *role {
+	r, ok := s.roles[name]
+	if !ok {
+		r = &role{id: s.id(), name: name, isSystem: true, permissions: make(map[string]bool)}
+		s.roles[name] = r
+	}
+	return r
+}
+
+func (s *Store) roleByID(id int) (*role, bool) {
+	for _, r := range s.roles {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Store) permissionByID(id int) (*permission, bool) {
+	for _, p := range s.permissions {
+		if p.id == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
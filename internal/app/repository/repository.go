@@ -0,0 +1,220 @@
+// Package repository describes the storage the handlers depend on, so that
+// they can run against Postgres in production and against memory in tests.
+// Writes that touch several rows are use cases of the service package and
+// keep its domain errors in every implementation.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	// ErrSystem is returned for roles and permissions the API relies on,
+	// which can't be deleted
+	ErrSystem = errors.New("part of the system")
+	ErrInUse  = errors.New("still in use")
+)
+
+// Page is one page of a list, Number starting at 1.
+type Page struct {
+	Number int
+	Limit  int
+}
+
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Limit
+}
+
+// Credentials is what logging in needs to know about a user.
+type Credentials struct {
+	UserID        int
+	PasswordHash  string
+	Role          string
+	EmailVerified bool
+}
+
+// User is an account that hasn't been deleted.
+type User struct {
+	ID            int
+	Fullname      string
+	Email         string
+	Role          string
+	PasswordHash  string
+	EmailVerified bool
+}
+
+// ExportWriter receives the data kept about a user section by section, one
+// record at a time, so that an export never has to be held in memory.
+type ExportWriter interface {
+	Section(name string) error
+	Record(record map[string]interface{}) error
+	EndSection() error
+}
+
+// Get, Profile, MarkEmailVerified, UpdateProfile and Delete return
+// service.ErrUserNotFound for users that don't exist or have been deleted.
+// Tokens that are unknown, expired or used are reported as
+// auth.ErrInvalidOneTimeToken.
+
+type Users interface {
+	Register(ctx context.Context, user service.NewUser) (int, error)
+	// Credentials returns ErrNotFound when no user has the email
+	Credentials(ctx context.Context, email string) (Credentials, error)
+	Get(ctx context.Context, userID int) (User, error)
+	Profile(ctx context.Context, userID int) (*models.Profile, error)
+	// UpdatePasswordHash only replaces oldHash, so that a password changed
+	// in the meantime is kept
+	UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error
+	// UpdateProfile and Delete return service.ErrPasswordChanged when the
+	// password hash is no longer currentHash
+	UpdateProfile(ctx context.Context, userID int, currentHash string, changes service.ProfileChanges) error
+	Delete(ctx context.Context, userID int, currentHash string) error
+	SetRole(ctx context.Context, userID int, role string) error
+	IssueVerificationToken(ctx context.Context, userID int, ttl time.Duration) (string, error)
+	VerifyEmail(ctx context.Context, token string) error
+	MarkEmailVerified(ctx context.Context, userID int) error
+	IssuePasswordResetToken(ctx context.Context, userID int, ttl time.Duration) (string, error)
+	ResetPassword(ctx context.Context, token string, newHash func(fullname, email string) (string, error)) (int, error)
+	// Export writes the sections of the user's data in a fixed order
+	Export(ctx context.Context, userID int, w ExportWriter) error
+}
+
+// The List methods return one page and the total number of rows.
+
+type Drivers interface {
+	List(ctx context.Context, page Page) ([]models.Driver, int, error)
+	// Assignments lists the driver's assignments newest first. With a
+	// non-zero at, only the one running at that time.
+	Assignments(ctx context.Context, driverID int, at time.Time) ([]models.VehicleAssignment, error)
+}
+
+type Owners interface {
+	List(ctx context.Context, page Page) ([]models.VehicleOwner, int, error)
+}
+
+// Get, Update, Delete and the assignment and status changes return
+// service.ErrVehicleNotFound when there is no vehicle with the ID.
+
+type Vehicles interface {
+	Add(ctx context.Context, ownerID int, vehicle service.NewVehicle) (int, error)
+	Get(ctx context.Context, vehicleID int) (models.Vehicle, error)
+	List(ctx context.Context, page Page) ([]models.Vehicle, int, error)
+	ListByOwner(ctx context.Context, ownerID int, page Page) ([]models.Vehicle, int, error)
+	Update(ctx context.Context, vehicleID int, changes service.VehicleChanges) error
+	Delete(ctx context.Context, vehicleID int, actor service.Actor) error
+	AssignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) error
+	// UnassignDriver and ReassignDriver return the driver the vehicle had
+	UnassignDriver(ctx context.Context, vehicleID int, actor service.Actor) (int, error)
+	ReassignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) (int, error)
+	// ChangeStatus returns the status the vehicle had
+	ChangeStatus(ctx context.Context, vehicleID int, to vehiclestatus.Status, reason string, actor service.Actor) (vehiclestatus.Status, error)
+	StatusHistory(ctx context.Context, vehicleID int) ([]models.VehicleStatusTransition, error)
+	Assignments(ctx context.Context, vehicleID int, at time.Time) ([]models.VehicleAssignment, error)
+}
+
+type Permissions interface {
+	HasPermission(role, permission string) (bool, error)
+	RolePermissions(role string) ([]string, error)
+}
+
+// Logins is the state behind authentication other than the users themselves:
+// lockouts, MFA enrolment, sessions, revoked access tokens and the audit log.
+type Logins interface {
+	LockedUntil(keys ...string) (time.Time, error)
+	RecordFailure(key string, throttle auth.Throttle) (time.Time, error)
+	ResetFailures(key string) error
+	MFAStatus(userID int) (enabled, required bool, err error)
+	CreateSession(userID int, userAgent, ip string) (sessionID, refreshToken string, err error)
+	RecordEvent(e auth.Event)
+
+	// Sessions and access tokens
+	RotateRefreshToken(refreshToken string) (userID int, sessionID, newToken string, err error)
+	RevokeSessionByRefreshToken(refreshToken string) error
+	// Sessions lists the user's active sessions, most recently used first
+	Sessions(userID int) ([]models.Session, error)
+	EndSession(userID int, sessionID string) (bool, error)
+	RevokeUserSessions(userID int) error
+	RevokeOtherSessions(userID int, keep string) error
+	RevokeToken(claims *auth.UserClaims) error
+	// RevokeUser rejects the user's access tokens issued so far, leaving the
+	// sessions to refresh them
+	RevokeUser(userID int) error
+
+	// MFA, with the errors of the auth package
+	StartMFAEnrollment(userID int, account string) (*auth.MFAEnrollment, error)
+	ConfirmMFAEnrollment(userID int, code string) error
+	VerifyMFACode(userID int, code string) error
+	CompleteMFAChallenge(challenge *auth.MFAChallengeClaims, code string) error
+	DisableMFA(userID int) error
+
+	// Used by the auth middleware
+	IsRevoked(claims *auth.UserClaims) (bool, error)
+	Touch(sessionID, ip string) error
+}
+
+// APIKeys are listed and revoked for the user they belong to. Revoke
+// reports false when the user has no key with the ID.
+type APIKeys interface {
+	Create(userID int, name string, scopes []string, expiresAt *time.Time) (id int, prefix, key string, err error)
+	List(userID int) ([]models.APIKey, error)
+	Revoke(userID, keyID int) (bool, error)
+	RevokeAll(userID int) error
+
+	// Used by the auth middleware
+	Validate(key string) (*auth.UserClaims, error)
+}
+
+// OAuthClients are the clients of the client_credentials grant. Authenticate
+// returns auth.ErrInvalidClient for unknown, revoked or wrong credentials.
+type OAuthClients interface {
+	Create(name string, userID int, scopes []string) (id int, clientID, secret string, err error)
+	List() ([]models.OAuthClient, error)
+	Revoke(id int) (bool, error)
+	Authenticate(clientID, secret string) (*auth.OAuthClient, error)
+
+	// Used by the auth middleware
+	Active(clientID string) (bool, error)
+}
+
+// Roles manages roles and permissions by ID and grants them by name. Changes
+// show in Permissions right away. Unknown IDs are reported as ErrNotFound.
+type Roles interface {
+	List(ctx context.Context) ([]models.Role, error)
+	Create(ctx context.Context, name string, selfRegistration bool) (int, error)
+	// Delete returns ErrInUse while users still have the role
+	Delete(ctx context.Context, roleID int) error
+	SetMFARequired(ctx context.Context, roleID int, required bool) error
+	Name(ctx context.Context, roleID int) (string, error)
+
+	Permissions(ctx context.Context) ([]models.Permission, error)
+	CreatePermission(ctx context.Context, name string) (int, error)
+	DeletePermission(ctx context.Context, permissionID int) error
+	PermissionName(ctx context.Context, permissionID int) (string, error)
+
+	Grant(ctx context.Context, role, permission string) error
+	Revoke(ctx context.Context, role, permission string) error
+}
+
+type Repositories struct {
+	Users        Users
+	Drivers      Drivers
+	Owners       Owners
+	Vehicles     Vehicles
+	Permissions  Permissions
+	Roles        Roles
+	Logins       Logins
+	APIKeys      APIKeys
+	OAuthClients OAuthClients
+	// Resources feeds the ownership policy
+	Resources policy.ResourceLoader
+}
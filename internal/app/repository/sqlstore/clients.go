@@ -0,0 +1,154 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// APIKeys delegates to the auth package, which validates keys against the
+// same tables.
+type APIKeys struct{}
+
+func (APIKeys) Create(userID int, name string, scopes []string, expiresAt *time.Time) (int, string, string, error) {
+	return auth.CreateAPIKey(userID, name, scopes, expiresAt)
+}
+
+func (APIKeys) List(userID int) ([]models.APIKey, error) {
+	query := `
+		SELECT
+			id,
+			name,
+			prefix,
+			created_at,
+			last_used_at,
+			expires_at,
+			revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC`
+	rows, err := db.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var lastUsedAt, expiresAt, revokedAt sql.NullTime
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = nullTimePtr(lastUsedAt)
+		key.ExpiresAt = nullTimePtr(expiresAt)
+		key.RevokedAt = nullTimePtr(revokedAt)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range keys {
+		keys[i].Scopes, err = auth.APIKeyScopes(keys[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (APIKeys) Revoke(userID, keyID int) (bool, error) {
+	result, err := db.DB.Exec(
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1 AND user_id = $2",
+		keyID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+func (APIKeys) RevokeAll(userID int) error {
+	return auth.RevokeUserAPIKeys(userID)
+}
+
+func (APIKeys) Validate(key string) (*auth.UserClaims, error) {
+	return auth.ValidateAPIKey(key)
+}
+
+type OAuthClients struct{}
+
+func (OAuthClients) Create(name string, userID int, scopes []string) (int, string, string, error) {
+	return auth.CreateOAuthClient(name, userID, scopes)
+}
+
+func (OAuthClients) List() ([]models.OAuthClient, error) {
+	query := `
+		SELECT
+			id,
+			client_id,
+			name,
+			user_id,
+			created_at,
+			revoked_at
+		FROM oauth_clients
+		ORDER BY id ASC`
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.OAuthClient{}
+	for rows.Next() {
+		var client models.OAuthClient
+		var revokedAt sql.NullTime
+		err := rows.Scan(&client.ID, &client.ClientID, &client.Name, &client.UserID, &client.CreatedAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+		client.RevokedAt = nullTimePtr(revokedAt)
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range clients {
+		clients[i].Scopes, err = auth.OAuthClientScopes(clients[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return clients, nil
+}
+
+func (OAuthClients) Revoke(id int) (bool, error) {
+	result, err := db.DB.Exec("UPDATE oauth_clients SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+func (OAuthClients) Authenticate(clientID, secret string) (*auth.OAuthClient, error) {
+	return auth.AuthenticateOAuthClient(clientID, secret)
+}
+
+func (OAuthClients) Active(clientID string) (bool, error) {
+	return auth.OAuthClientActive(clientID)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,209 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+)
+
+// Roles invalidates what auth.Permissions has cached of the roles it changes.
+type Roles struct{}
+
+func (Roles) List(ctx context.Context) ([]models.Role, error) {
+	query := `
+		SELECT
+			r.id,
+			r.name,
+			r.is_system,
+			r.self_registration,
+			r.mfa_required,
+			p.name
+		FROM roles AS r
+		LEFT JOIN role_permissions AS rp
+		ON r.id = rp.role_id
+		LEFT JOIN permissions AS p
+		ON rp.permission_id = p.id
+		ORDER BY r.id ASC, p.name ASC`
+	rows, err := db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var thisRole models.Role
+		var permission sql.NullString
+		if err := rows.Scan(
+			&thisRole.ID,
+			&thisRole.Name,
+			&thisRole.IsSystem,
+			&thisRole.SelfRegistration,
+			&thisRole.MFARequired,
+			&permission,
+		); err != nil {
+			return nil, err
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].ID != thisRole.ID {
+			thisRole.Permissions = []string{}
+			roles = append(roles, thisRole)
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (Roles) Create(ctx context.Context, name string, selfRegistration bool) (int, error) {
+	query := `
+		INSERT INTO roles (
+			name,
+			self_registration
+		) VALUES ($1, $2
+		) RETURNING id`
+	var roleID int
+	err := db.DB.QueryRowContext(ctx, query, name, selfRegistration).Scan(&roleID)
+	if db.IsViolation(err, db.UniqueViolation) {
+		return 0, repository.ErrExists
+	}
+	return roleID, err
+}
+
+func (Roles) Delete(ctx context.Context, roleID int) error {
+	var name string
+	var isSystem bool
+	err := db.DB.QueryRowContext(ctx, "SELECT name, is_system FROM roles WHERE id = $1", roleID).Scan(&name, &isSystem)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if isSystem {
+		return repository.ErrSystem
+	}
+
+	_, err = db.DB.ExecContext(ctx, "DELETE FROM roles WHERE id = $1", roleID)
+	if db.IsViolation(err, db.ForeignKeyViolation) {
+		return repository.ErrInUse
+	}
+	if err != nil {
+		return err
+	}
+	auth.Permissions.Invalidate(name)
+	return nil
+}
+
+func (Roles) SetMFARequired(ctx context.Context, roleID int, required bool) error {
+	result, err := db.DB.ExecContext(ctx, "UPDATE roles SET mfa_required = $1 WHERE id = $2", required, roleID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (Roles) Name(ctx context.Context, roleID int) (string, error) {
+	var name string
+	err := db.DB.QueryRowContext(ctx, "SELECT name FROM roles WHERE id = $1", roleID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", repository.ErrNotFound
+	}
+	return name, err
+}
+
+func (Roles) Permissions(ctx context.Context) ([]models.Permission, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT id, name, is_system FROM permissions ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var thisPermission models.Permission
+		if err := rows.Scan(&thisPermission.ID, &thisPermission.Name, &thisPermission.IsSystem); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, thisPermission)
+	}
+	return permissions, rows.Err()
+}
+
+func (Roles) CreatePermission(ctx context.Context, name string) (int, error) {
+	var permissionID int
+	err := db.DB.QueryRowContext(ctx, "INSERT INTO permissions (name) VALUES ($1) RETURNING id", name).Scan(&permissionID)
+	if db.IsViolation(err, db.UniqueViolation) {
+		return 0, repository.ErrExists
+	}
+	return permissionID, err
+}
+
+func (Roles) DeletePermission(ctx context.Context, permissionID int) error {
+	var isSystem bool
+	err := db.DB.QueryRowContext(ctx, "SELECT is_system FROM permissions WHERE id = $1", permissionID).Scan(&isSystem)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if isSystem {
+		return repository.ErrSystem
+	}
+
+	// role_permissions rows go with it through ON DELETE CASCADE
+	if _, err := db.DB.ExecContext(ctx, "DELETE FROM permissions WHERE id = $1", permissionID); err != nil {
+		return err
+	}
+	auth.Permissions.InvalidateAll()
+	return nil
+}
+
+func (Roles) PermissionName(ctx context.Context, permissionID int) (string, error) {
+	var name string
+	err := db.DB.QueryRowContext(ctx, "SELECT name FROM permissions WHERE id = $1", permissionID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", repository.ErrNotFound
+	}
+	return name, err
+}
+
+func (Roles) Grant(ctx context.Context, role, permission string) error {
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT
+			r.id, p.id
+		FROM
+			roles r, permissions p
+		WHERE
+			r.name = $1 AND p.name = $2
+		ON CONFLICT DO NOTHING`
+	if _, err := db.DB.ExecContext(ctx, query, role, permission); err != nil {
+		return err
+	}
+	auth.Permissions.Invalidate(role)
+	return nil
+}
+
+func (Roles) Revoke(ctx context.Context, role, permission string) error {
+	query := `
+		DELETE FROM role_permissions
+		WHERE
+			role_id = (SELECT id FROM roles WHERE name = $1) AND
+			permission_id = (SELECT id FROM permissions WHERE name = $2)`
+	if _, err := db.DB.ExecContext(ctx, query, role, permission); err != nil {
+		return err
+	}
+	auth.Permissions.Invalidate(role)
+	return nil
+}
@@ -0,0 +1,809 @@
+// Package sqlstore implements the repositories on the main database, db.DB,
+// which it shares with the service and auth packages. Its queries run on both
+// Postgres and SQLite.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/app/repository"
+	"github.com/kwagmire/fleet-management-api/internal/app/service"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/models"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/policy"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+func New() repository.Repositories {
+	return repository.Repositories{
+		Users:        Users{},
+		Drivers:      Drivers{},
+		Owners:       Owners{},
+		Vehicles:     Vehicles{},
+		Permissions:  auth.Permissions,
+		Roles:        Roles{},
+		Logins:       Logins{},
+		APIKeys:      APIKeys{},
+		OAuthClients: OAuthClients{},
+		Resources:    policy.DBLoader{},
+	}
+}
+
+type Users struct{}
+
+func (Users) Register(ctx context.Context, user service.NewUser) (int, error) {
+	return service.RegisterUser(ctx, user)
+}
+
+func (Users) Credentials(ctx context.Context, email string) (repository.Credentials, error) {
+	query := `
+		SELECT
+			id,
+			password_hash,
+			role,
+			email_verified_at IS NOT NULL
+		FROM users
+		WHERE email = $1`
+	var credentials repository.Credentials
+	err := db.DB.QueryRowContext(ctx, query, email).Scan(
+		&credentials.UserID,
+		&credentials.PasswordHash,
+		&credentials.Role,
+		&credentials.EmailVerified,
+	)
+	if err == sql.ErrNoRows {
+		return credentials, repository.ErrNotFound
+	}
+	return credentials, err
+}
+
+func (Users) Get(ctx context.Context, userID int) (repository.User, error) {
+	query := `
+		SELECT
+			id,
+			fullname,
+			email,
+			role,
+			password_hash,
+			email_verified_at IS NOT NULL
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL`
+	var user repository.User
+	err := db.DB.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Fullname,
+		&user.Email,
+		&user.Role,
+		&user.PasswordHash,
+		&user.EmailVerified,
+	)
+	if err == sql.ErrNoRows {
+		return user, service.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (Users) Profile(ctx context.Context, userID int) (*models.Profile, error) {
+	query := `
+		SELECT
+			u.id,
+			u.fullname,
+			u.email,
+			u.role,
+			u.email_verified_at IS NOT NULL,
+			d.license_id,
+			d.assigned,
+			v.id,
+			v.make,
+			v.model,
+			v.year,
+			v.license_plate,
+			v.status,
+			o.fleet_size
+		FROM users AS u
+		LEFT JOIN drivers AS d
+		ON u.id = d.user_id
+		LEFT JOIN vehicles AS v
+		ON d.user_id = v.driver_id
+		LEFT JOIN vehicle_owners AS o
+		ON u.id = o.user_id
+		WHERE u.id = $1 AND u.deleted_at IS NULL`
+	var profile models.Profile
+	var licenseID, vehicleMake, vehicleModel, licensePlate, status sql.NullString
+	var assigned sql.NullBool
+	var vehicleID, year, fleetSize sql.NullInt64
+	err := db.DB.QueryRowContext(ctx, query, userID).Scan(
+		&profile.ID,
+		&profile.Fullname,
+		&profile.Email,
+		&profile.Role,
+		&profile.EmailVerified,
+		&licenseID,
+		&assigned,
+		&vehicleID,
+		&vehicleMake,
+		&vehicleModel,
+		&year,
+		&licensePlate,
+		&status,
+		&fleetSize,
+	)
+	if err == sql.ErrNoRows {
+		return nil, service.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if licenseID.Valid {
+		profile.Driver = &models.DriverProfile{LicenseID: licenseID.String, Assigned: assigned.Bool}
+		if vehicleID.Valid {
+			profile.Driver.Vehicle = &models.AssignedVehicle{
+				ID:           int(vehicleID.Int64),
+				Make:         vehicleMake.String,
+				Model:        vehicleModel.String,
+				Year:         int(year.Int64),
+				LicensePlate: licensePlate.String,
+				Status:       status.String,
+			}
+		}
+	}
+	if fleetSize.Valid {
+		profile.Owner = &models.OwnerProfile{FleetSize: int(fleetSize.Int64)}
+	}
+	return &profile, nil
+}
+
+func (Users) UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error {
+	_, err := db.DB.ExecContext(ctx,
+		"UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3", newHash, userID, oldHash,
+	)
+	return err
+}
+
+func (Users) UpdateProfile(ctx context.Context, userID int, currentHash string, changes service.ProfileChanges) error {
+	return service.UpdateProfile(ctx, userID, currentHash, changes)
+}
+
+func (Users) Delete(ctx context.Context, userID int, currentHash string) error {
+	return service.DeleteAccount(ctx, userID, currentHash)
+}
+
+func (Users) SetRole(ctx context.Context, userID int, role string) error {
+	return service.SetUserRole(ctx, userID, role)
+}
+
+func (Users) IssueVerificationToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return auth.IssueOneTimeToken(userID, auth.PurposeEmailVerification, ttl)
+}
+
+func (Users) VerifyEmail(ctx context.Context, token string) error {
+	return service.VerifyEmail(ctx, token)
+}
+
+func (Users) MarkEmailVerified(ctx context.Context, userID int) error {
+	result, err := db.DB.ExecContext(ctx,
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = $1 AND deleted_at IS NULL", userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return service.ErrUserNotFound
+	}
+	return nil
+}
+
+func (Users) IssuePasswordResetToken(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return auth.IssueOneTimeToken(userID, auth.PurposePasswordReset, ttl)
+}
+
+func (Users) ResetPassword(ctx context.Context, token string, newHash func(fullname, email string) (string, error)) (int, error) {
+	return service.ResetPassword(ctx, token, newHash)
+}
+
+// exportSections are the tables exported along with the profile, each one
+// filtered by the user's ID.
+var exportSections = []struct {
+	name  string
+	query string
+}{
+	{"vehicles_owned", "SELECT id, make, model, year, license_plate, status, driver_id FROM vehicles WHERE owner_id = $1 ORDER BY id"},
+	{"vehicle_assignments", "SELECT vehicle_id, license_plate, started_at, ended_at FROM vehicle_assignments WHERE driver_id = $1 ORDER BY started_at"},
+	{"sessions", "SELECT id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at FROM sessions WHERE user_id = $1 ORDER BY created_at"},
+	{"api_keys", "SELECT id, name, prefix, created_at, last_used_at, expires_at, revoked_at FROM api_keys WHERE user_id = $1 ORDER BY id"},
+	{"oauth_clients", "SELECT id, client_id, name, created_at, revoked_at FROM oauth_clients WHERE user_id = $1 ORDER BY id"},
+	{"mfa", "SELECT created_at, enabled_at FROM user_mfa WHERE user_id = $1"},
+	{"auth_events", "SELECT event_type, email, ip_address, details, created_at FROM auth_events WHERE user_id = $1 ORDER BY id"},
+}
+
+func (Users) Export(ctx context.Context, userID int, w repository.ExportWriter) error {
+	for _, section := range exportSections {
+		if err := exportRows(ctx, w, section.name, section.query, userID); err != nil {
+			return fmt.Errorf("failed to export %s: %w", section.name, err)
+		}
+	}
+	return nil
+}
+
+// exportRows writes the result of query as one section, each row keyed by
+// column.
+func exportRows(ctx context.Context, w repository.ExportWriter, name, query string, args ...interface{}) error {
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := w.Section(name); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				record[column] = string(b)
+			} else {
+				record[column] = values[i]
+			}
+		}
+		if err := w.Record(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.EndSection()
+}
+
+type Drivers struct{}
+
+func (Drivers) List(ctx context.Context, page repository.Page) ([]models.Driver, int, error) {
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM drivers").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT
+			u.id,
+			u.fullname,
+			u.email,
+			d.license_id,
+			d.assigned,
+			v.make,
+			v.model,
+			v.year,
+			v.license_plate
+		FROM users AS u
+		JOIN
+			drivers AS d
+			ON u.id = d.user_id
+		LEFT JOIN
+			vehicles AS v
+			ON d.user_id = v.driver_id
+		ORDER BY u.id ASC
+		LIMIT $1 OFFSET $2`
+	rows, err := db.DB.QueryContext(ctx, query, page.Limit, page.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var drivers []models.Driver
+	for rows.Next() {
+		var thisDriver models.Driver
+		if err := rows.Scan(
+			&thisDriver.UserID,
+			&thisDriver.Fullname,
+			&thisDriver.Email,
+			&thisDriver.LicenseID,
+			&thisDriver.Assigned,
+			&thisDriver.VehicleMake,
+			&thisDriver.VehicleModel,
+			&thisDriver.VehicleYear,
+			&thisDriver.VehicleLicensePlate,
+		); err != nil {
+			return nil, 0, err
+		}
+		drivers = append(drivers, thisDriver)
+	}
+	return drivers, total, rows.Err()
+}
+
+func (Drivers) Assignments(ctx context.Context, driverID int, at time.Time) ([]models.VehicleAssignment, error) {
+	return assignments(ctx, "a.driver_id", driverID, at)
+}
+
+// assignments lists the assignments whose column matches id. column is never
+// user input.
+func assignments(ctx context.Context, column string, id int, at time.Time) ([]models.VehicleAssignment, error) {
+	query := `
+		SELECT
+			a.id,
+			a.vehicle_id,
+			a.license_plate,
+			a.driver_id,
+			u.fullname,
+			a.assigned_by,
+			a.unassigned_by,
+			a.started_at,
+			a.ended_at
+		FROM vehicle_assignments AS a
+		JOIN users AS u
+		ON a.driver_id = u.id
+		WHERE ` + column + ` = $1`
+	args := []interface{}{id}
+	if !at.IsZero() {
+		query += " AND a.started_at <= $2 AND (a.ended_at IS NULL OR a.ended_at > $2)"
+		args = append(args, at)
+	}
+	query += " ORDER BY a.started_at DESC, a.id DESC"
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.VehicleAssignment{}
+	for rows.Next() {
+		var assignment models.VehicleAssignment
+		var vehicleID, assignedBy, unassignedBy sql.NullInt64
+		var endedAt sql.NullTime
+		if err := rows.Scan(
+			&assignment.ID,
+			&vehicleID,
+			&assignment.LicensePlate,
+			&assignment.DriverID,
+			&assignment.DriverName,
+			&assignedBy,
+			&unassignedBy,
+			&assignment.StartedAt,
+			&endedAt,
+		); err != nil {
+			return nil, err
+		}
+		assignment.VehicleID = nullIntPtr(vehicleID)
+		assignment.AssignedBy = nullIntPtr(assignedBy)
+		assignment.UnassignedBy = nullIntPtr(unassignedBy)
+		assignment.EndedAt = nullTimePtr(endedAt)
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+func nullIntPtr(i sql.NullInt64) *int {
+	if !i.Valid {
+		return nil
+	}
+	n := int(i.Int64)
+	return &n
+}
+
+type Owners struct{}
+
+func (Owners) List(ctx context.Context, page repository.Page) ([]models.VehicleOwner, int, error) {
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM vehicle_owners").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT
+			u.id,
+			u.fullname,
+			u.email,
+			vo.fleet_size
+		FROM users AS u
+		JOIN
+			vehicle_owners AS vo
+			ON u.id = vo.user_id
+		ORDER BY u.id ASC
+		LIMIT $1 OFFSET $2`
+	rows, err := db.DB.QueryContext(ctx, query, page.Limit, page.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var owners []models.VehicleOwner
+	for rows.Next() {
+		var thisOwner models.VehicleOwner
+		if err := rows.Scan(
+			&thisOwner.UserID,
+			&thisOwner.Fullname,
+			&thisOwner.Email,
+			&thisOwner.FleetSize,
+		); err != nil {
+			return nil, 0, err
+		}
+		owners = append(owners, thisOwner)
+	}
+	return owners, total, rows.Err()
+}
+
+type Vehicles struct{}
+
+func (Vehicles) Add(ctx context.Context, ownerID int, vehicle service.NewVehicle) (int, error) {
+	return service.AddVehicle(ctx, ownerID, vehicle)
+}
+
+func (Vehicles) Get(ctx context.Context, vehicleID int) (models.Vehicle, error) {
+	query := `
+		SELECT
+			v.id,
+			v.make,
+			v.model,
+			v.year,
+			v.license_plate,
+			v.status,
+			u.fullname AS driver_name,
+			u.email AS driver_email,
+			uo.fullname AS owner_name,
+			uo.email AS owner_email
+		FROM vehicles AS v
+		LEFT JOIN
+			drivers AS d
+			ON v.driver_id = d.user_id
+		LEFT JOIN
+			users AS u
+			ON d.user_id = u.id
+		LEFT JOIN
+			users AS uo
+			ON v.owner_id = uo.id
+		WHERE v.id = $1`
+	var thisVehicle models.Vehicle
+	err := db.DB.QueryRowContext(ctx, query, vehicleID).Scan(
+		&thisVehicle.ID,
+		&thisVehicle.Make,
+		&thisVehicle.Model,
+		&thisVehicle.Year,
+		&thisVehicle.LicensePlate,
+		&thisVehicle.Status,
+		&thisVehicle.DriverName,
+		&thisVehicle.DriverEmail,
+		&thisVehicle.OwnerName,
+		&thisVehicle.OwnerEmail,
+	)
+	if err == sql.ErrNoRows {
+		return thisVehicle, service.ErrVehicleNotFound
+	}
+	return thisVehicle, err
+}
+
+func (Vehicles) Update(ctx context.Context, vehicleID int, changes service.VehicleChanges) error {
+	return service.UpdateVehicle(ctx, vehicleID, changes)
+}
+
+func (Vehicles) Delete(ctx context.Context, vehicleID int, actor service.Actor) error {
+	return service.DeleteVehicle(ctx, vehicleID, actor)
+}
+
+func (Vehicles) AssignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) error {
+	return service.AssignDriver(ctx, vehicleID, driverID, actor)
+}
+
+func (Vehicles) UnassignDriver(ctx context.Context, vehicleID int, actor service.Actor) (int, error) {
+	return service.UnassignDriver(ctx, vehicleID, actor)
+}
+
+func (Vehicles) ReassignDriver(ctx context.Context, vehicleID, driverID int, actor service.Actor) (int, error) {
+	return service.ReassignDriver(ctx, vehicleID, driverID, actor)
+}
+
+func (Vehicles) ChangeStatus(
+	ctx context.Context,
+	vehicleID int,
+	to vehiclestatus.Status,
+	reason string,
+	actor service.Actor,
+) (vehiclestatus.Status, error) {
+	return service.ChangeVehicleStatus(ctx, vehicleID, to, reason, actor)
+}
+
+func (Vehicles) StatusHistory(ctx context.Context, vehicleID int) ([]models.VehicleStatusTransition, error) {
+	query := `
+		SELECT
+			t.id,
+			t.from_status,
+			t.to_status,
+			t.actor_id,
+			u.fullname,
+			t.reason,
+			t.created_at
+		FROM vehicle_status_transitions AS t
+		LEFT JOIN users AS u
+		ON t.actor_id = u.id
+		WHERE t.vehicle_id = $1
+		ORDER BY t.created_at, t.id`
+	rows, err := db.DB.QueryContext(ctx, query, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []models.VehicleStatusTransition{}
+	for rows.Next() {
+		var transition models.VehicleStatusTransition
+		var actorID sql.NullInt64
+		var actorName, reason sql.NullString
+		if err := rows.Scan(
+			&transition.ID,
+			&transition.FromStatus,
+			&transition.ToStatus,
+			&actorID,
+			&actorName,
+			&reason,
+			&transition.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			transition.ActorID = nullIntPtr(actorID)
+			transition.ActorName = &actorName.String
+		}
+		if reason.Valid {
+			transition.Reason = &reason.String
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, rows.Err()
+}
+
+func (Vehicles) Assignments(ctx context.Context, vehicleID int, at time.Time) ([]models.VehicleAssignment, error) {
+	return assignments(ctx, "a.vehicle_id", vehicleID, at)
+}
+
+func (Vehicles) List(ctx context.Context, page repository.Page) ([]models.Vehicle, int, error) {
+	var total int
+	if err := db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM vehicles").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT
+			v.id,
+			v.make,
+			v.model,
+			v.year,
+			v.license_plate,
+			v.status,
+			u.fullname AS driver_name,
+			u.email AS driver_email,
+			uo.fullname AS owner_name,
+			uo.email AS owner_email
+		FROM vehicles AS v
+		LEFT JOIN
+			drivers AS d
+			ON v.driver_id = d.user_id
+		LEFT JOIN
+			users AS u
+			ON d.user_id = u.id
+		LEFT JOIN
+			users AS uo
+			ON v.owner_id = uo.id
+		ORDER BY v.id ASC
+		LIMIT $1 OFFSET $2`
+	rows, err := db.DB.QueryContext(ctx, query, page.Limit, page.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var vehicles []models.Vehicle
+	for rows.Next() {
+		var thisVehicle models.Vehicle
+		if err := rows.Scan(
+			&thisVehicle.ID,
+			&thisVehicle.Make,
+			&thisVehicle.Model,
+			&thisVehicle.Year,
+			&thisVehicle.LicensePlate,
+			&thisVehicle.Status,
+			&thisVehicle.DriverName,
+			&thisVehicle.DriverEmail,
+			&thisVehicle.OwnerName,
+			&thisVehicle.OwnerEmail,
+		); err != nil {
+			return nil, 0, err
+		}
+		vehicles = append(vehicles, thisVehicle)
+	}
+	return vehicles, total, rows.Err()
+}
+
+// ListByOwner's total is the owner's fleet size.
+func (Vehicles) ListByOwner(ctx context.Context, ownerID int, page repository.Page) ([]models.Vehicle, int, error) {
+	var fleetSize int
+	err := db.DB.QueryRowContext(ctx, "SELECT fleet_size FROM vehicle_owners WHERE user_id = $1", ownerID).Scan(&fleetSize)
+	if err == sql.ErrNoRows {
+		return nil, 0, service.ErrOwnerNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT
+			v.id,
+			v.make,
+			v.model,
+			v.year,
+			v.license_plate,
+			v.status,
+			u.fullname,
+			u.email
+		FROM vehicles AS v
+		LEFT JOIN
+			drivers AS d
+			ON v.driver_id = d.user_id
+		LEFT JOIN
+			users AS u
+			ON d.user_id = u.id
+		WHERE v.owner_id = $1
+		ORDER BY v.id ASC
+		LIMIT $2 OFFSET $3`
+	rows, err := db.DB.QueryContext(ctx, query, ownerID, page.Limit, page.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var vehicles []models.Vehicle
+	for rows.Next() {
+		var thisVehicle models.Vehicle
+		if err := rows.Scan(
+			&thisVehicle.ID,
+			&thisVehicle.Make,
+			&thisVehicle.Model,
+			&thisVehicle.Year,
+			&thisVehicle.LicensePlate,
+			&thisVehicle.Status,
+			&thisVehicle.DriverName,
+			&thisVehicle.DriverEmail,
+		); err != nil {
+			return nil, 0, err
+		}
+		vehicles = append(vehicles, thisVehicle)
+	}
+	return vehicles, fleetSize, rows.Err()
+}
+
+// Logins delegates to the auth package, which keeps this state in the
+// database.
+type Logins struct{}
+
+func (Logins) LockedUntil(keys ...string) (time.Time, error) {
+	return auth.LoginLockedUntil(keys...)
+}
+
+func (Logins) RecordFailure(key string, throttle auth.Throttle) (time.Time, error) {
+	return auth.RecordLoginFailure(key, throttle)
+}
+
+func (Logins) ResetFailures(key string) error {
+	return auth.ResetLoginFailures(key)
+}
+
+func (Logins) MFAStatus(userID int) (bool, bool, error) {
+	return auth.MFAStatus(userID)
+}
+
+func (Logins) CreateSession(userID int, userAgent, ip string) (string, string, error) {
+	return auth.CreateSession(userID, userAgent, ip)
+}
+
+func (Logins) RecordEvent(e auth.Event) {
+	auth.RecordEvent(e)
+}
+
+func (Logins) RotateRefreshToken(refreshToken string) (int, string, string, error) {
+	return auth.RotateRefreshToken(refreshToken)
+}
+
+func (Logins) RevokeSessionByRefreshToken(refreshToken string) error {
+	return auth.RevokeSessionByRefreshToken(refreshToken)
+}
+
+func (Logins) Sessions(userID int) ([]models.Session, error) {
+	query := `
+		SELECT
+			id,
+			COALESCE(user_agent, ''),
+			COALESCE(ip_address, ''),
+			created_at,
+			last_seen_at,
+			expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC`
+	rows, err := db.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (Logins) EndSession(userID int, sessionID string) (bool, error) {
+	return auth.EndSession(userID, sessionID)
+}
+
+func (Logins) RevokeUserSessions(userID int) error {
+	return auth.RevokeUserSessions(userID)
+}
+
+func (Logins) RevokeOtherSessions(userID int, keep string) error {
+	return auth.RevokeOtherSessions(userID, keep)
+}
+
+func (Logins) RevokeToken(claims *auth.UserClaims) error {
+	return auth.Revocations.RevokeToken(claims)
+}
+
+func (Logins) RevokeUser(userID int) error {
+	return auth.Revocations.RevokeUser(userID)
+}
+
+func (Logins) StartMFAEnrollment(userID int, account string) (*auth.MFAEnrollment, error) {
+	return auth.StartMFAEnrollment(userID, account)
+}
+
+func (Logins) ConfirmMFAEnrollment(userID int, code string) error {
+	return auth.ConfirmMFAEnrollment(userID, code)
+}
+
+func (Logins) VerifyMFACode(userID int, code string) error {
+	return auth.VerifyMFACode(userID, code)
+}
+
+func (Logins) CompleteMFAChallenge(challenge *auth.MFAChallengeClaims, code string) error {
+	return auth.CompleteMFAChallenge(challenge, code)
+}
+
+func (Logins) DisableMFA(userID int) error {
+	return auth.DisableMFA(userID)
+}
+
+func (Logins) IsRevoked(claims *auth.UserClaims) (bool, error) {
+	return auth.Revocations.IsRevoked(claims)
+}
+
+func (Logins) Touch(sessionID, ip string) error {
+	return auth.SessionActivity.Touch(sessionID, ip)
+}
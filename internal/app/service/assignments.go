@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+// AssignDriver gives an available vehicle to an unassigned driver and puts it
+// in use.
+func AssignDriver(ctx context.Context, vehicleID, driverID int, actor Actor) error {
+	return inTx(ctx, func(tx *sql.Tx) error {
+		vehicle, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if vehicle.Status != vehiclestatus.Available || vehicle.HasDriver {
+			return ErrVehicleUnavailable
+		}
+
+		// The driver is part of the same change as the status
+		vehicle.HasDriver = true
+		if err := vehiclestatus.Default.Check(vehicle.Vehicle, vehiclestatus.InUse, actor.HasPermission); err != nil {
+			return err
+		}
+
+		assigned, err := lockDriver(tx, driverID)
+		if err != nil {
+			return err
+		}
+		if assigned {
+			return ErrDriverAssigned
+		}
+
+		if _, err := tx.Exec("UPDATE vehicles SET driver_id = $1 WHERE id = $2", driverID, vehicleID); err != nil {
+			return err
+		}
+		reason := "Driver " + strconv.Itoa(driverID) + " assigned"
+		if err := changeStatus(tx, vehicleID, vehicle.Status, vehiclestatus.InUse, actor.UserID, reason); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE drivers SET assigned = true WHERE user_id = $1", driverID); err != nil {
+			return err
+		}
+		return startAssignment(tx, vehicleID, driverID, actor.UserID)
+	})
+}
+
+// UnassignDriver ends the vehicle's current assignment and returns the driver
+// it had. A vehicle in use becomes available.
+func UnassignDriver(ctx context.Context, vehicleID int, actor Actor) (int, error) {
+	var driverID int
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		vehicle, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if !vehicle.HasDriver {
+			return ErrNoDriver
+		}
+		driverID = vehicle.DriverID
+
+		// The status changes first so that the release_vehicle_without_driver
+		// trigger doesn't record the transition a second time
+		if vehicle.Status == vehiclestatus.InUse {
+			vehicle.HasDriver = false
+			if err := vehiclestatus.Default.Check(vehicle.Vehicle, vehiclestatus.Available, actor.HasPermission); err != nil {
+				return err
+			}
+			reason := "Driver " + strconv.Itoa(driverID) + " unassigned"
+			if err := changeStatus(tx, vehicleID, vehicle.Status, vehiclestatus.Available, actor.UserID, reason); err != nil {
+				return err
+			}
+		}
+
+		if err := endAssignment(tx, vehicleID, actor.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE vehicles SET driver_id = NULL WHERE id = $1", vehicleID); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE drivers SET assigned = false WHERE user_id = $1", driverID)
+		return err
+	})
+	return driverID, err
+}
+
+// ReassignDriver swaps the vehicle's driver for another unassigned driver in
+// one step and returns the previous one. The status doesn't change.
+func ReassignDriver(ctx context.Context, vehicleID, driverID int, actor Actor) (int, error) {
+	var previousID int
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		vehicle, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if !vehicle.HasDriver {
+			return ErrNoDriver
+		}
+		previousID = vehicle.DriverID
+		if previousID == driverID {
+			return ErrSameDriver
+		}
+
+		// The previous driver is already covered by the vehicle's lock, only
+		// the new one needs locking
+		assigned, err := lockDriver(tx, driverID)
+		if err != nil {
+			return err
+		}
+		if assigned {
+			return ErrDriverAssigned
+		}
+
+		if err := endAssignment(tx, vehicleID, actor.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE vehicles SET driver_id = $1 WHERE id = $2", driverID, vehicleID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"UPDATE drivers SET assigned = (user_id = $2) WHERE user_id IN ($1, $2)", previousID, driverID,
+		)
+		if err != nil {
+			return err
+		}
+		return startAssignment(tx, vehicleID, driverID, actor.UserID)
+	})
+	return previousID, err
+}
+
+// lockDriver locks the driver until tx ends and tells whether they already
+// have a vehicle.
+func lockDriver(tx *sql.Tx, driverID int) (bool, error) {
+	var assigned bool
+	err := tx.QueryRow("SELECT assigned FROM drivers WHERE user_id = $1"+db.ForUpdate(), driverID).Scan(&assigned)
+	if err == sql.ErrNoRows {
+		return false, ErrDriverNotFound
+	}
+	return assigned, err
+}
+
+func startAssignment(tx *sql.Tx, vehicleID, driverID, actorID int) error {
+	query := `
+		INSERT INTO vehicle_assignments (vehicle_id, license_plate, driver_id, assigned_by)
+		SELECT id, license_plate, $2, $3 FROM vehicles WHERE id = $1`
+	_, err := tx.Exec(query, vehicleID, driverID, actorID)
+	return err
+}
+
+func endAssignment(tx *sql.Tx, vehicleID, actorID int) error {
+	query := `
+		UPDATE vehicle_assignments
+		SET
+			ended_at = CURRENT_TIMESTAMP,
+			unassigned_by = $2
+		WHERE
+			vehicle_id = $1 AND ended_at IS NULL`
+	_, err := tx.Exec(query, vehicleID, actorID)
+	return err
+}
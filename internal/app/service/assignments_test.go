@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db/dbtest"
+)
+
+// These tests run on a fresh SQLite database and, given one as
+// TEST_DB_CONNECTION_STRING, on a PostgreSQL database as well.
+
+var fixtureID atomic.Int64
+
+// unique returns a value no other fixture of this test run has used. It is
+// short enough for a license plate.
+func unique(prefix string) string {
+	return fmt.Sprintf("%s%d-%d", prefix, os.Getpid(), fixtureID.Add(1))
+}
+
+func newDriver(t *testing.T) int {
+	t.Helper()
+	id, err := RegisterUser(context.Background(), NewUser{
+		Name:         "Test Driver",
+		Email:        unique("driver") + "@example.com",
+		PasswordHash: "!",
+		Role:         "driver",
+		LicenseID:    unique("L"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create driver: %v", err)
+	}
+	return id
+}
+
+func newOwner(t *testing.T) int {
+	t.Helper()
+	id, err := RegisterUser(context.Background(), NewUser{
+		Name:         "Test Owner",
+		Email:        unique("owner") + "@example.com",
+		PasswordHash: "!",
+		Role:         "vehicle_owner",
+	})
+	if err != nil {
+		t.Fatalf("failed to create owner: %v", err)
+	}
+	return id
+}
+
+func newVehicle(t *testing.T, ownerID int) int {
+	t.Helper()
+	id, err := AddVehicle(context.Background(), ownerID, NewVehicle{
+		Make:         "Toyota",
+		Model:        "Corolla",
+		Year:         2020,
+		LicensePlate: unique("P"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create vehicle: %v", err)
+	}
+	return id
+}
+
+func testActor(userID int) Actor {
+	return Actor{
+		UserID:        userID,
+		HasPermission: func(string) (bool, error) { return true, nil },
+	}
+}
+
+// race runs fn n times at once and returns the errors in call order.
+func race(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func TestAssignOneDriverToVehiclesConcurrently(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T) {
+		ctx := context.Background()
+
+		ownerID := newOwner(t)
+		driverID := newDriver(t)
+		const n = 8
+		vehicles := make([]int, n)
+		for i := range vehicles {
+			vehicles[i] = newVehicle(t, ownerID)
+		}
+
+		errs := race(n, func(i int) error {
+			return AssignDriver(ctx, vehicles[i], driverID, testActor(ownerID))
+		})
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrDriverAssigned):
+				t.Errorf("got error %v, want %v", err, ErrDriverAssigned)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("%d assignments succeeded, want 1", succeeded)
+		}
+
+		var withDriver, openAssignments int
+		err := db.DB.QueryRow("SELECT COUNT(*) FROM vehicles WHERE driver_id = $1", driverID).Scan(&withDriver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.DB.QueryRow(
+			"SELECT COUNT(*) FROM vehicle_assignments WHERE driver_id = $1 AND ended_at IS NULL", driverID,
+		).Scan(&openAssignments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withDriver != 1 || openAssignments != 1 {
+			t.Errorf("driver has %d vehicles and %d open assignments, want 1 and 1", withDriver, openAssignments)
+		}
+	})
+}
+
+func TestAssignDriversToOneVehicleConcurrently(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T) {
+		ctx := context.Background()
+
+		ownerID := newOwner(t)
+		vehicleID := newVehicle(t, ownerID)
+		const n = 8
+		drivers := make([]int, n)
+		for i := range drivers {
+			drivers[i] = newDriver(t)
+		}
+
+		errs := race(n, func(i int) error {
+			return AssignDriver(ctx, vehicleID, drivers[i], testActor(ownerID))
+		})
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrVehicleUnavailable):
+				t.Errorf("got error %v, want %v", err, ErrVehicleUnavailable)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("%d assignments succeeded, want 1", succeeded)
+		}
+
+		assignedDrivers := 0
+		for _, driverID := range drivers {
+			var assigned bool
+			err := db.DB.QueryRow("SELECT assigned FROM drivers WHERE user_id = $1", driverID).Scan(&assigned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assigned {
+				assignedDrivers++
+			}
+		}
+		if assignedDrivers != 1 {
+			t.Errorf("%d drivers are marked assigned, want 1", assignedDrivers)
+		}
+	})
+}
+
+func TestReassignToOneDriverConcurrently(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T) {
+		ctx := context.Background()
+
+		ownerID := newOwner(t)
+		const n = 4
+		vehicles := make([]int, n)
+		for i := range vehicles {
+			vehicles[i] = newVehicle(t, ownerID)
+			if err := AssignDriver(ctx, vehicles[i], newDriver(t), testActor(ownerID)); err != nil {
+				t.Fatalf("failed to assign driver: %v", err)
+			}
+		}
+		driverID := newDriver(t)
+
+		errs := race(n, func(i int) error {
+			_, err := ReassignDriver(ctx, vehicles[i], driverID, testActor(ownerID))
+			return err
+		})
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrDriverAssigned):
+				t.Errorf("got error %v, want %v", err, ErrDriverAssigned)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("%d reassignments succeeded, want 1", succeeded)
+		}
+	})
+}
+
+func TestAddVehicleKeepsFleetSize(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T) {
+
+		ownerID := newOwner(t)
+		plate := unique("P")
+		errs := race(4, func(i int) error {
+			_, err := AddVehicle(context.Background(), ownerID, NewVehicle{
+				Make:         "Toyota",
+				Model:        "Corolla",
+				Year:         2020,
+				LicensePlate: plate,
+			})
+			return err
+		})
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrPlateTaken):
+				t.Errorf("got error %v, want %v", err, ErrPlateTaken)
+			}
+		}
+
+		var fleetSize int
+		err := db.DB.QueryRow("SELECT fleet_size FROM vehicle_owners WHERE user_id = $1", ownerID).Scan(&fleetSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if succeeded != 1 || fleetSize != 1 {
+			t.Errorf("%d vehicles added and fleet size %d, want 1 and 1", succeeded, fleetSize)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Package service holds the use cases that write more than one row. Each one
+// runs in a single transaction, locks the rows it decides on before reading
+// them and reports failures as the domain errors below rather than as driver
+// errors, so a handler never has to know about constraint names.
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+var (
+	ErrRoleNotAllowed = errors.New("role can't be registered for")
+	ErrEmailTaken     = errors.New("email already exists")
+	ErrLicenseTaken   = errors.New("license ID already registered")
+
+	ErrOwnerNotFound   = errors.New("vehicle owner not found")
+	ErrVehicleNotFound = errors.New("vehicle not found")
+	ErrDriverNotFound  = errors.New("driver not found")
+
+	ErrPlateTaken     = errors.New("license plate already registered")
+	ErrInvalidVehicle = errors.New("vehicle doesn't meet system requirements")
+	ErrValueTooLong   = errors.New("a field is too long")
+
+	ErrVehicleUnavailable = errors.New("vehicle is not available for assignment")
+	ErrNoDriver           = errors.New("vehicle has no driver")
+	ErrDriverAssigned     = errors.New("driver is already assigned to a vehicle")
+	ErrSameDriver         = errors.New("driver is already assigned to this vehicle")
+	ErrSameStatus         = errors.New("vehicle already has this status")
+
+	ErrUserNotFound = errors.New("user not found")
+	ErrRoleNotFound = errors.New("role doesn't exist")
+	ErrSameRole     = errors.New("user already has this role")
+	ErrProfileRole  = errors.New("users can't be moved in or out of the driver and vehicle_owner roles")
+	ErrLastAdmin    = errors.New("the last super_admin can't be given another role")
+
+	ErrPasswordChanged    = errors.New("password was changed in the meantime")
+	ErrVehiclesRegistered = errors.New("owner still has registered vehicles")
+)
+
+// Actor is the user a use case runs for. HasPermission is asked about the
+// permissions of vehicle status transitions.
+type Actor struct {
+	UserID        int
+	HasPermission func(permission string) (bool, error)
+}
+
+// constraintErrors maps the constraints a use case can run into, after all of
+// its own checks passed, to what they mean. Hitting one means another request
+// got there first.
+var constraintErrors = map[string]error{
+	"users_email_key":                      ErrEmailTaken,
+	"drivers_license_id_key":               ErrLicenseTaken,
+	"vehicles_license_plate_key":           ErrPlateTaken,
+	"vehicles_driver_id_key":               ErrDriverAssigned,
+	"idx_vehicle_assignments_open_driver":  ErrDriverAssigned,
+	"idx_vehicle_assignments_open_vehicle": ErrVehicleUnavailable,
+	"check_vehicle_year":                   ErrInvalidVehicle,
+	// SQLite reports the columns of unique constraints rather than a name
+	"users.email":                    ErrEmailTaken,
+	"drivers.license_id":             ErrLicenseTaken,
+	"vehicles.license_plate":         ErrPlateTaken,
+	"vehicles.driver_id":             ErrDriverAssigned,
+	"vehicle_assignments.driver_id":  ErrDriverAssigned,
+	"vehicle_assignments.vehicle_id": ErrVehicleUnavailable,
+}
+
+// translate turns constraint violations into domain errors and leaves
+// anything else alone.
+func translate(err error) error {
+	violation, ok := db.AsViolation(err)
+	if !ok {
+		return err
+	}
+	if domainError, ok := constraintErrors[violation.Constraint]; ok {
+		return domainError
+	}
+	switch violation.Kind {
+	case db.CheckViolation:
+		return ErrInvalidVehicle
+	case db.ValueTooLong:
+		return ErrValueTooLong
+	}
+	return err
+}
+
+// inTx runs fn in a transaction that is committed when fn returns nil and
+// rolled back otherwise.
+func inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return translate(err)
+	}
+	return translate(tx.Commit())
+}
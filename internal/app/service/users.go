@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+type NewUser struct {
+	Name         string
+	Email        string
+	PasswordHash string
+	Role         string
+	// LicenseID is required for drivers and ignored for everyone else
+	LicenseID string
+}
+
+// RegisterUser creates a self-registered user together with their driver or
+// vehicle owner profile.
+func RegisterUser(ctx context.Context, user NewUser) (int, error) {
+	var userID int
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		var selfRegistration bool
+		err := tx.QueryRow("SELECT self_registration FROM roles WHERE name = $1", user.Role).Scan(&selfRegistration)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if !selfRegistration {
+			return ErrRoleNotAllowed
+		}
+
+		query := `
+			INSERT INTO users (
+				fullname,
+				password_hash,
+				email,
+				role
+			) VALUES ($1, $2, $3, $4
+			) RETURNING id`
+		err = tx.QueryRow(query, user.Name, user.PasswordHash, user.Email, user.Role).Scan(&userID)
+		if err != nil {
+			return err
+		}
+
+		switch user.Role {
+		case "driver":
+			_, err = tx.Exec("INSERT INTO drivers (user_id, license_id) VALUES ($1, $2)", userID, user.LicenseID)
+		case "vehicle_owner":
+			_, err = tx.Exec("INSERT INTO vehicle_owners (user_id, fleet_size) VALUES ($1, 0)", userID)
+		}
+		return err
+	})
+	return userID, err
+}
+
+// profileRoles come with a driver or vehicle owner profile, which users can't
+// be given or lose by changing role.
+var profileRoles = map[string]bool{"driver": true, "vehicle_owner": true}
+
+// CreateAdmin creates a super_admin. Their email counts as verified as it was
+// given by an operator rather than through /register.
+func CreateAdmin(ctx context.Context, user NewUser) (int, error) {
+	var userID int
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = insertAdmin(tx, user)
+		return err
+	})
+	return userID, err
+}
+
+// BootstrapAdmin creates the first super_admin and does nothing once there is
+// one. It reports whether it created user.
+func BootstrapAdmin(ctx context.Context, user NewUser) (bool, error) {
+	created := false
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		var admins int
+		err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'super_admin' AND deleted_at IS NULL").Scan(&admins)
+		if err != nil || admins > 0 {
+			return err
+		}
+		_, err = insertAdmin(tx, user)
+		created = err == nil
+		return err
+	})
+	return created, err
+}
+
+func insertAdmin(tx *sql.Tx, user NewUser) (int, error) {
+	query := `
+		INSERT INTO users (
+			fullname,
+			password_hash,
+			email,
+			role,
+			email_verified_at
+		) VALUES ($1, $2, $3, 'super_admin', CURRENT_TIMESTAMP
+		) RETURNING id`
+	var userID int
+	err := tx.QueryRow(query, user.Name, user.PasswordHash, user.Email).Scan(&userID)
+	return userID, err
+}
+
+// SetUserRole moves a user between roles that don't come with a profile,
+// keeping at least one super_admin.
+func SetUserRole(ctx context.Context, userID int, role string) error {
+	return inTx(ctx, func(tx *sql.Tx) error {
+		var currentRole string
+		err := tx.QueryRow("SELECT role FROM users WHERE id = $1"+db.ForUpdate(), userID).Scan(&currentRole)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)", role).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRoleNotFound
+		}
+
+		if currentRole == role {
+			return ErrSameRole
+		}
+		if profileRoles[currentRole] || profileRoles[role] {
+			return ErrProfileRole
+		}
+		if currentRole == "super_admin" {
+			// Lock the other admins too, so that two of them can't demote
+			// each other at once
+			rows, err := tx.Query("SELECT id FROM users WHERE role = 'super_admin' AND id <> $1"+db.ForUpdate(), userID)
+			if err != nil {
+				return err
+			}
+			otherAdmins := 0
+			for rows.Next() {
+				otherAdmins++
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if otherAdmins == 0 {
+				return ErrLastAdmin
+			}
+		}
+
+		_, err = tx.Exec("UPDATE users SET role = $1 WHERE id = $2", role, userID)
+		return err
+	})
+}
+
+// SetPassword replaces a user's password hash. Ending their sessions is up to
+// the caller.
+func SetPassword(ctx context.Context, userID int, passwordHash string) error {
+	result, err := db.DB.ExecContext(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ProfileChanges holds the fields of their account a user changes. Nil ones
+// are kept. A new Email has to be verified again.
+type ProfileChanges struct {
+	Fullname     *string
+	Email        *string
+	LicenseID    *string
+	PasswordHash *string
+}
+
+// UpdateProfile writes changes to the user and their driver profile, as long
+// as their password hash is still currentHash: changes allowed by checking one
+// password aren't made once it has been replaced.
+func UpdateProfile(ctx context.Context, userID int, currentHash string, changes ProfileChanges) error {
+	return inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockAccount(tx, userID, currentHash); err != nil {
+			return err
+		}
+
+		if changes.Fullname != nil {
+			if _, err := tx.Exec("UPDATE users SET fullname = $1 WHERE id = $2", *changes.Fullname, userID); err != nil {
+				return err
+			}
+		}
+		if changes.Email != nil {
+			_, err := tx.Exec("UPDATE users SET email = $1, email_verified_at = NULL WHERE id = $2", *changes.Email, userID)
+			if err != nil {
+				return err
+			}
+		}
+		if changes.LicenseID != nil {
+			if _, err := tx.Exec("UPDATE drivers SET license_id = $1 WHERE user_id = $2", *changes.LicenseID, userID); err != nil {
+				return err
+			}
+		}
+		if changes.PasswordHash != nil {
+			if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", *changes.PasswordHash, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteAccount anonymizes a user, as long as their password hash is still
+// currentHash, and revokes their sessions and access tokens along with it.
+// Removing an owner would cascade to their vehicles and silently unassign
+// their drivers, so owners have to delete their vehicles first.
+func DeleteAccount(ctx context.Context, userID int, currentHash string) error {
+	var revoked func()
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockAccount(tx, userID, currentHash); err != nil {
+			return err
+		}
+
+		var vehicleCount int
+		err := tx.QueryRow("SELECT COUNT(*) FROM vehicles WHERE owner_id = $1", userID).Scan(&vehicleCount)
+		if err != nil {
+			return err
+		}
+		if vehicleCount > 0 {
+			return ErrVehiclesRegistered
+		}
+
+		if err := anonymizeUser(tx, userID); err != nil {
+			return err
+		}
+		// The account is only gone once its tokens stop working
+		revoked, err = auth.Revocations.RevokeUserTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	revoked()
+	return nil
+}
+
+// anonymizeUser strips everything personal from a user while keeping the
+// users row, so references to it stay valid. The driver profile is deleted,
+// which releases their vehicle through vehicles.driver_id ON DELETE SET NULL.
+// Sessions are kept for the revocation to show in them.
+func anonymizeUser(tx *sql.Tx, userID int) error {
+	statements := []string{
+		"DELETE FROM drivers WHERE user_id = $1",
+		"DELETE FROM vehicle_owners WHERE user_id = $1",
+		"UPDATE sessions SET user_agent = NULL, ip_address = NULL WHERE user_id = $1",
+		"DELETE FROM user_tokens WHERE user_id = $1",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_mfa WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM oauth_clients WHERE user_id = $1",
+		"UPDATE auth_events SET email = NULL, ip_address = NULL, details = NULL WHERE user_id = $1",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET
+			fullname = 'Deleted user',
+			email = $1,
+			password_hash = '!',
+			email_verified_at = NULL,
+			deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+	_, err := tx.Exec(query, fmt.Sprintf("deleted-%d@deleted.invalid", userID), userID)
+	return err
+}
+
+// lockAccount locks a user who hasn't been deleted until tx ends and checks
+// that their password hash is still currentHash.
+func lockAccount(tx *sql.Tx, userID int, currentHash string) error {
+	var passwordHash string
+	err := tx.QueryRow(
+		"SELECT password_hash FROM users WHERE id = $1 AND deleted_at IS NULL"+db.ForUpdate(), userID,
+	).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if passwordHash != currentHash {
+		return ErrPasswordChanged
+	}
+	return nil
+}
+
+// VerifyEmail consumes an email verification token and marks the address of
+// the user it was issued to as verified.
+func VerifyEmail(ctx context.Context, token string) error {
+	return inTx(ctx, func(tx *sql.Tx) error {
+		userID, err := auth.ConsumeOneTimeToken(tx, token, auth.PurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND email_verified_at IS NULL", userID,
+		)
+		return err
+	})
+}
+
+// ResetPassword consumes a password reset token and gives the user it was
+// issued to the password hash newHash returns. newHash is passed the user's
+// name and email, which the password policy needs, and its errors are
+// returned as they are. Whoever knew the old password must not stay logged
+// in, so the user's sessions and access tokens are revoked with it.
+func ResetPassword(ctx context.Context, token string, newHash func(fullname, email string) (string, error)) (int, error) {
+	var userID int
+	var revoked func()
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		userID, err = auth.ConsumeOneTimeToken(tx, token, auth.PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		var fullname, email string
+		err = tx.QueryRow("SELECT fullname, email FROM users WHERE id = $1", userID).Scan(&fullname, &email)
+		if err != nil {
+			return err
+		}
+		passwordHash, err := newHash(fullname, email)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID); err != nil {
+			return err
+		}
+
+		revoked, err = auth.Revocations.RevokeUserTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	revoked()
+	return userID, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db/dbtest"
+)
+
+func newAdmin(t *testing.T) int {
+	t.Helper()
+	id, err := CreateAdmin(context.Background(), NewUser{
+		Name:         "Test Admin",
+		Email:        unique("admin") + "@example.com",
+		PasswordHash: "!",
+	})
+	if err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	return id
+}
+
+func TestBootstrapAdminOnlyOnce(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T) {
+		ctx := context.Background()
+		first := NewUser{Name: "First Admin", Email: unique("first") + "@example.com", PasswordHash: "!"}
+		if _, err := BootstrapAdmin(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+
+		second := NewUser{Name: "Second Admin", Email: unique("second") + "@example.com", PasswordHash: "!"}
+		created, err := BootstrapAdmin(ctx, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exists bool
+		err = db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", second.Email).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created || exists {
+			t.Error("bootstrapped a second admin")
+		}
+	})
+}
+
+func TestSetUserRoleKeepsLastAdmin(t *testing.T) {
+	// Every other test's admins would count on a shared database
+	dbtest.Fresh(t)
+	ctx := context.Background()
+	if _, err := db.DB.Exec("INSERT INTO roles (name) VALUES ('dispatcher')"); err != nil {
+		t.Fatal(err)
+	}
+
+	admins := []int{newAdmin(t), newAdmin(t)}
+	if err := SetUserRole(ctx, admins[0], "driver"); !errors.Is(err, ErrProfileRole) {
+		t.Errorf("got error %v, want %v", err, ErrProfileRole)
+	}
+	if err := SetUserRole(ctx, admins[0], "nonexistent"); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrRoleNotFound)
+	}
+
+	// Two admins demoting each other at once leave one of them
+	errs := race(len(admins), func(i int) error {
+		return SetUserRole(ctx, admins[i], "dispatcher")
+	})
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrLastAdmin):
+			t.Errorf("got error %v, want %v", err, ErrLastAdmin)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d admins were demoted, want 1", succeeded)
+	}
+}
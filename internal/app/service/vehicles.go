@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/vehiclestatus"
+)
+
+type NewVehicle struct {
+	Make         string
+	Model        string
+	Year         int
+	LicensePlate string
+}
+
+// AddVehicle registers an available vehicle for the owner and grows their
+// fleet.
+func AddVehicle(ctx context.Context, ownerID int, vehicle NewVehicle) (int, error) {
+	var vehicleID int
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		// Locking the owner serialises their fleet_size updates
+		var lockedID int
+		err := tx.QueryRow("SELECT user_id FROM vehicle_owners WHERE user_id = $1"+db.ForUpdate(), ownerID).Scan(&lockedID)
+		if err == sql.ErrNoRows {
+			return ErrOwnerNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO vehicles (
+				make,
+				model,
+				year,
+				license_plate,
+				status,
+				owner_id
+			) VALUES ($1, $2, $3, $4, $5, $6
+			) RETURNING id`
+		err = tx.QueryRow(query, vehicle.Make, vehicle.Model, vehicle.Year, vehicle.LicensePlate,
+			vehiclestatus.Available, ownerID).Scan(&vehicleID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE vehicle_owners SET fleet_size = fleet_size + 1 WHERE user_id = $1", ownerID)
+		return err
+	})
+	return vehicleID, err
+}
+
+// VehicleChanges holds the fields of a vehicle to change. Nil ones are kept.
+type VehicleChanges struct {
+	Make         *string
+	Model        *string
+	Year         *int
+	LicensePlate *string
+}
+
+// UpdateVehicle writes changes, which must hold at least one field.
+func UpdateVehicle(ctx context.Context, vehicleID int, changes VehicleChanges) error {
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, column+" = $"+strconv.Itoa(len(args)))
+	}
+	if changes.Make != nil {
+		set("make", *changes.Make)
+	}
+	if changes.Model != nil {
+		set("model", *changes.Model)
+	}
+	if changes.Year != nil {
+		set("year", *changes.Year)
+	}
+	if changes.LicensePlate != nil {
+		set("license_plate", *changes.LicensePlate)
+	}
+
+	args = append(args, vehicleID)
+	query := "UPDATE vehicles SET " + strings.Join(sets, ", ") + " WHERE id = $" + strconv.Itoa(len(args))
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return translate(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+// DeleteVehicle removes the vehicle, releases its driver and shrinks the
+// owner's fleet. The assignment history keeps the plate.
+func DeleteVehicle(ctx context.Context, vehicleID int, actor Actor) error {
+	return inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := lockVehicle(tx, vehicleID); err != nil {
+			return err
+		}
+		if err := endAssignment(tx, vehicleID, actor.UserID); err != nil {
+			return err
+		}
+
+		var ownerID, driverID sql.NullInt64
+		err := tx.QueryRow(
+			"DELETE FROM vehicles WHERE id = $1 RETURNING owner_id, driver_id", vehicleID,
+		).Scan(&ownerID, &driverID)
+		if err != nil {
+			return err
+		}
+
+		if driverID.Valid {
+			if _, err := tx.Exec("UPDATE drivers SET assigned = false WHERE user_id = $1", driverID.Int64); err != nil {
+				return err
+			}
+		}
+		if ownerID.Valid {
+			query := `
+				UPDATE vehicle_owners
+				SET
+					fleet_size = fleet_size - 1
+				WHERE
+					user_id = $1 AND fleet_size > 0`
+			if _, err := tx.Exec(query, ownerID.Int64); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ChangeVehicleStatus moves the vehicle to status to if the state machine
+// allows it for actor, and records the transition.
+func ChangeVehicleStatus(ctx context.Context, vehicleID int, to vehiclestatus.Status, reason string, actor Actor) (vehiclestatus.Status, error) {
+	var from vehiclestatus.Status
+	err := inTx(ctx, func(tx *sql.Tx) error {
+		vehicle, err := lockVehicle(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		from = vehicle.Status
+		if to == vehicle.Status {
+			return ErrSameStatus
+		}
+		if err := vehiclestatus.Default.Check(vehicle.Vehicle, to, actor.HasPermission); err != nil {
+			return err
+		}
+		return changeStatus(tx, vehicleID, vehicle.Status, to, actor.UserID, reason)
+	})
+	return from, err
+}
+
+// lockedVehicle is what the use cases decide on, read under a row lock.
+type lockedVehicle struct {
+	vehiclestatus.Vehicle
+	DriverID int
+}
+
+// lockVehicle locks the vehicle until tx ends. Every use case locks the
+// vehicle before any driver, so two of them can't deadlock.
+func lockVehicle(tx *sql.Tx, vehicleID int) (lockedVehicle, error) {
+	var vehicle lockedVehicle
+	var driverID sql.NullInt64
+	err := tx.QueryRow(
+		"SELECT status, driver_id FROM vehicles WHERE id = $1"+db.ForUpdate(), vehicleID,
+	).Scan(&vehicle.Status, &driverID)
+	if err == sql.ErrNoRows {
+		return vehicle, ErrVehicleNotFound
+	}
+	vehicle.HasDriver = driverID.Valid
+	vehicle.DriverID = int(driverID.Int64)
+	return vehicle, err
+}
+
+// changeStatus writes the new status and records the transition. The caller
+// is responsible for having checked it against the state machine.
+func changeStatus(tx *sql.Tx, vehicleID int, from, to vehiclestatus.Status, actorID int, reason string) error {
+	if _, err := tx.Exec("UPDATE vehicles SET status = $1 WHERE id = $2", to, vehicleID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO vehicle_status_transitions (vehicle_id, from_status, to_status, actor_id, reason)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
+	_, err := tx.Exec(query, vehicleID, from, to, actorID, reason)
+	return err
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const (
+	apiKeyPrefix = "fmk_"
+	APIKeyHeader = "X-API-Key"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+
+// NewAPIKey returns a fresh key and the prefix that identifies it in listings.
+// Keys look like fmk_<prefix>_<secret>.
+func NewAPIKey() (string, string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret, err := NewOpaqueToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + hex.EncodeToString(b)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// APIKeyFromRequest returns the API key sent either in the X-API-Key header
+// or as "Authorization: ApiKey <key>".
+func APIKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return key
+	}
+	return ""
+}
+
+// ValidateAPIKey looks the key up and returns claims equivalent to those of
+// the owning user, restricted to the key's scopes.
+func ValidateAPIKey(key string) (*UserClaims, error) {
+	query := `
+		SELECT
+			k.id,
+			k.user_id,
+			u.role,
+			k.expires_at,
+			k.revoked_at
+		FROM api_keys AS k
+		JOIN users AS u
+		ON k.user_id = u.id
+		WHERE k.key_hash = $1`
+	var keyID, userID int
+	var role string
+	var expiresAt, revokedAt sql.NullTime
+	err := db.DB.QueryRow(query, HashToken(key)).Scan(&keyID, &userID, &role, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid || (expiresAt.Valid && time.Now().After(expiresAt.Time)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	scopes, err := APIKeyScopes(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recording every single use would turn each read into a write, a minute
+	// of precision is plenty to spot unused keys.
+	_, err = db.DB.Exec(
+		"UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)",
+		keyID, time.Now().Add(-time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record API key use: %w", err)
+	}
+
+	return &UserClaims{
+		UserID:   userID,
+		Role:     role,
+		APIKeyID: keyID,
+		Scopes:   scopes,
+	}, nil
+}
+
+func APIKeyScopes(keyID int) ([]string, error) {
+	query := `
+		SELECT
+			p.name
+		FROM api_key_scopes AS s
+		JOIN permissions AS p
+		ON s.permission_id = p.id
+		WHERE s.api_key_id = $1
+		ORDER BY p.name ASC`
+	rows, err := db.DB.Query(query, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := []string{}
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
+
+// CreateAPIKey stores a new key for userID limited to scopes and returns its
+// ID, the prefix and the key itself. The key can't be recovered later.
+func CreateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (int, string, string, error) {
+	key, prefix, err := NewAPIKey()
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer tx.Rollback()
+
+	var keyID int
+	query := `
+		INSERT INTO api_keys (
+			user_id,
+			name,
+			prefix,
+			key_hash,
+			expires_at
+		) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+	err = tx.QueryRow(query, userID, name, prefix, HashToken(key), expiresAt).Scan(&keyID)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to store API key: %w", err)
+	}
+
+	for _, scope := range scopes {
+		_, err = tx.Exec(
+			"INSERT INTO api_key_scopes (api_key_id, permission_id) SELECT $1, id FROM permissions WHERE name = $2 ON CONFLICT DO NOTHING",
+			keyID, scope,
+		)
+		if err != nil {
+			return 0, "", "", fmt.Errorf("failed to store API key scope: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", err
+	}
+	return keyID, prefix, key, nil
+}
+
+// RevokeUserAPIKeys revokes every API key of userID.
+func RevokeUserAPIKeys(userID int) error {
+	_, err := db.DB.Exec("UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,63 +13,206 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// UserClaims only carries the identity and the role. Permissions are resolved
+// from the role on every request, see PermissionResolver.
 type UserClaims struct {
-	UserID      int      `json:"user_id"`
-	Role        string   `json:"role"`
-	Permissions []string `json:"permissions"`
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+	// ClientID and Scope are set on tokens issued to OAuth clients, Scope
+	// being the space separated list of granted permissions.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// APIKeyID is only set for requests authenticated with an API key. Both
+	// API keys and OAuth clients are limited to the permissions in Scopes.
+	APIKeyID int      `json:"-"`
+	Scopes   []string `json:"-"`
+	// SessionID ties a user's access token to the session it was issued
+	// for, so ending the session also rejects the token.
+	SessionID string `json:"sid,omitempty"`
+	// Act identifies the admin behind an impersonation token. UserID and Role
+	// are then those of the impersonated user.
+	Act *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type Actor struct {
+	UserID int `json:"user_id"`
+}
+
+// Scoped reports whether the caller is restricted to Scopes rather than
+// having every permission of its role.
+func (c *UserClaims) Scoped() bool {
+	return c.APIKeyID != 0 || c.ClientID != ""
+}
+
+// HasScope reports whether permission is within the caller's scopes. It is
+// always true for callers that aren't scoped.
+func (c *UserClaims) HasScope(permission string) bool {
+	if !c.Scoped() {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
 type contextKey string
 
 const userDetailsKey contextKey = "userDetails"
 
-func GenerateToken(userID int, role string, permissions []string) (string, error) {
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	if secretKey == "" {
-		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set")
+const (
+	AccessTokenTTL   = 2 * time.Hour
+	ImpersonationTTL = 15 * time.Minute
+)
+
+func GenerateToken(userID int, role, sessionID string) (string, error) {
+	claims, err := newAccessClaims(userID, role, AccessTokenTTL)
+	if err != nil {
+		return "", err
 	}
+	claims.SessionID = sessionID
+	return signToken(claims)
+}
+
+// GenerateImpersonationToken issues a short-lived token for userID carrying
+// actorID in the act claim.
+func GenerateImpersonationToken(userID int, role string, actorID int) (string, error) {
+	claims, err := newAccessClaims(userID, role, ImpersonationTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.Act = &Actor{UserID: actorID}
+	return signToken(claims)
+}
 
-	claims := UserClaims{
-		userID,
-		role,
-		permissions,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Hour)),
+func newAccessClaims(userID int, role string, ttl time.Duration) (*UserClaims, error) {
+	jti, err := NewOpaqueToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserClaims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
+	}, nil
+}
+
+func ValidateToken(jwtString string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(jwtString, &UserClaims{}, verificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("token parsing error: %w", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid or expired token")
+	}
+	// MFA challenges are signed with the same keys but only grant access to
+	// POST /login/mfa
+	for _, aud := range claims.Audience {
+		if aud == mfaAudience {
+			return nil, fmt.Errorf("not an access token")
+		}
+	}
+	if claims.ClientID != "" {
+		claims.Scopes = strings.Fields(claims.Scope)
+	}
+
+	return claims, nil
 }
 
-func ValidateToken(jwtString string) (*UserClaims, error) {
+// signToken signs with the current key of the key set when JWT_KEYS_DIR is
+// configured and falls back to the shared HS256 secret otherwise.
+func signToken(claims jwt.Claims) (string, error) {
+	if Keys != nil {
+		key, err := Keys.Current()
+		if err != nil {
+			return "", err
+		}
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.private)
+	}
+
 	secretKey := os.Getenv("JWT_SECRET_KEY")
 	if secretKey == "" {
-		return nil, fmt.Errorf("JWT_SECRET_KEY environment variable not set")
+		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set")
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secretKey))
+}
 
-	token, err := jwt.ParseWithClaims(jwtString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// verificationKey selects the key a token was signed with. HS256 tokens are
+// still accepted while JWT_SECRET_KEY is set so that switching to asymmetric
+// keys does not log everybody out.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+		if Keys == nil {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := Keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if key.Method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("signing method %v does not match key %q", token.Header["alg"], kid)
+		}
+		return key.Public(), nil
+	case *jwt.SigningMethodHMAC:
+		secretKey := os.Getenv("JWT_SECRET_KEY")
+		if secretKey == "" {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(secretKey), nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("token parsing error: %w", err)
-	}
-
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
+}
 
-	return nil, fmt.Errorf("invalid or expired token")
+// Authenticator holds what checking a request's credentials depends on.
+// ValidateAPIKey and OAuthClientActive may be nil, which rejects API keys and
+// OAuth client tokens.
+type Authenticator struct {
+	IsRevoked         func(claims *UserClaims) (bool, error)
+	TouchSession      func(sessionID, ip string) error
+	HasRolePermission func(role, permission string) (bool, error)
+	RecordEvent       func(e Event)
+	ValidateAPIKey    func(key string) (*UserClaims, error)
+	OAuthClientActive func(clientID string) (bool, error)
 }
 
-func AuthMiddleware(nextHandler http.HandlerFunc) http.HandlerFunc {
+func (a *Authenticator) Middleware(nextHandler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if key := APIKeyFromRequest(r); key != "" {
+			if a.ValidateAPIKey == nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			claims, err := a.ValidateAPIKey(key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to validate API key: %v", err)
+				http.Error(w, "Failed to verify API key", http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), userDetailsKey, claims)
+			nextHandler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -87,11 +231,50 @@ func AuthMiddleware(nextHandler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		revoked, err := a.IsRevoked(claims)
+		if err != nil {
+			log.Printf("Failed to check token revocation: %v", err)
+			http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.SessionID != "" {
+			if err := a.TouchSession(claims.SessionID, ClientIP(r)); err != nil {
+				log.Printf("Failed to record session activity: %v", err)
+			}
+		}
+
+		if claims.Act != nil {
+			a.logImpersonatedRequest(r, claims)
+		}
+
+		if claims.ClientID != "" {
+			if a.OAuthClientActive == nil {
+				http.Error(w, "OAuth client has been revoked", http.StatusUnauthorized)
+				return
+			}
+			active, err := a.OAuthClientActive(claims.ClientID)
+			if err != nil {
+				log.Printf("Failed to check OAuth client: %v", err)
+				http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "OAuth client has been revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
 		ctx := context.WithValue(r.Context(), userDetailsKey, claims)
 		nextHandler.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
-func RequirePermission(permission string, nextHandler http.HandlerFunc) http.HandlerFunc {
+
+func (a *Authenticator) RequirePermission(permission string, nextHandler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the claims from the request context
 		userDetails, ok := GetUserDetailsFromContext(r.Context())
@@ -100,13 +283,13 @@ func RequirePermission(permission string, nextHandler http.HandlerFunc) http.Han
 			return
 		}
 
-		// Check if the required permission exists in the user's permissions slice
-		hasPermission := false
-		for _, p := range userDetails.Permissions {
-			if p == permission {
-				hasPermission = true
-				break
-			}
+		// Resolve the role's current permissions rather than trusting a list
+		// frozen at login time
+		hasPermission, err := a.HasPermission(userDetails, permission)
+		if err != nil {
+			log.Printf("Failed to resolve permissions: %v", err)
+			http.Error(w, "Failed to resolve permissions", http.StatusInternalServerError)
+			return
 		}
 
 		if !hasPermission {
@@ -120,6 +303,54 @@ func RequirePermission(permission string, nextHandler http.HandlerFunc) http.Han
 	}
 }
 
+// RequireUserLogin is for endpoints that manage the account itself, such as
+// MFA or API keys, which API keys, OAuth clients and impersonating admins must
+// not be able to reach.
+func RequireUserLogin(nextHandler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userDetails, ok := GetUserDetailsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Authentication context missing", http.StatusForbidden)
+			return
+		}
+		if userDetails.Scoped() || userDetails.Act != nil {
+			http.Error(w, "Only available to logged in users", http.StatusForbidden)
+			return
+		}
+		nextHandler.ServeHTTP(w, r)
+	}
+}
+
+func (a *Authenticator) HasPermission(claims *UserClaims, permission string) (bool, error) {
+	if !claims.HasScope(permission) {
+		return false, nil
+	}
+	// Support acts as the user, never as an admin, whatever the
+	// impersonated role has been granted since the token was issued
+	if claims.Act != nil && IsAdminPermission(permission) {
+		return false, nil
+	}
+	return a.HasRolePermission(claims.Role, permission)
+}
+
+// IsAdminPermission reports whether permission belongs to the admin:
+// namespace, which impersonation tokens never get.
+func IsAdminPermission(permission string) bool {
+	return strings.HasPrefix(permission, "admin:")
+}
+
+// logImpersonatedRequest records every request made with an impersonation
+// token against both the admin and the impersonated user.
+func (a *Authenticator) logImpersonatedRequest(r *http.Request, claims *UserClaims) {
+	log.Printf("Admin %d acting as user %d: %s %s", claims.Act.UserID, claims.UserID, r.Method, r.URL.Path)
+	a.RecordEvent(Event{
+		UserID:  claims.UserID,
+		Type:    EventImpersonatedUse,
+		IP:      ClientIP(r),
+		Details: fmt.Sprintf("actor=%d method=%s path=%s jti=%s", claims.Act.UserID, r.Method, r.URL.Path, claims.ID),
+	})
+}
+
 func GetUserDetailsFromContext(ctx context.Context) (*UserClaims, bool) {
 	userDetails, ok := ctx.Value(userDetailsKey).(*UserClaims)
 	return userDetails, ok
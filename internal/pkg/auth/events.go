@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const (
+	EventLoginSucceeded  = "login_succeeded"
+	EventLoginFailed     = "login_failed"
+	EventLoginBlocked    = "login_blocked"
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventMFALocked       = "mfa_locked"
+	EventAccountUnlocked = "account_unlocked"
+	EventImpersonation   = "impersonation_started"
+	EventImpersonatedUse = "impersonated_request"
+)
+
+// Event is one entry of the auth_events log. UserID is zero when the event
+// can't be tied to an existing account.
+type Event struct {
+	UserID  int
+	Type    string
+	Email   string
+	IP      string
+	Details string
+}
+
+// RecordEvent writes to the auth event log. Failing to record an event must
+// not fail the request that caused it, so errors are only logged.
+func RecordEvent(e Event) {
+	query := `
+		INSERT INTO auth_events (
+			user_id,
+			event_type,
+			email,
+			ip_address,
+			details
+		) VALUES ($1, $2, $3, $4, $5)`
+	_, err := db.DB.Exec(query,
+		sql.NullInt64{Int64: int64(e.UserID), Valid: e.UserID != 0},
+		e.Type,
+		sql.NullString{String: e.Email, Valid: e.Email != ""},
+		sql.NullString{String: e.IP, Valid: e.IP != ""},
+		sql.NullString{String: e.Details, Valid: e.Details != ""},
+	)
+	if err != nil {
+		log.Printf("Failed to record auth event %s: %v", e.Type, err)
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one PEM private key from the keys directory. Its kid is the
+// file name without extension. A name starting with a UTC date or timestamp,
+// e.g. 20261101-main.pem or 20261101T090000Z-main.pem, schedules the key to
+// take over signing at that time; other keys are active as soon as they are
+// loaded.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	ActiveFrom time.Time
+
+	private crypto.Signer
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// KeySet holds the asymmetric keys used to sign and verify tokens. The newest
+// active key signs; older keys keep verifying until a newer key has been
+// signing for longer than grace, after which nothing they signed can still
+// be valid and they are retired.
+type KeySet struct {
+	dir   string
+	grace time.Duration
+
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+// Keys is nil when JWT_KEYS_DIR is not configured, in which case tokens are
+// signed with the HS256 JWT_SECRET_KEY.
+var Keys *KeySet
+
+func LoadKeySet(dir string, grace time.Duration) (*KeySet, error) {
+	ks := &KeySet{dir: dir, grace: grace}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no PEM keys found in %s", ks.dir)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ActiveFrom.Equal(keys[j].ActiveFrom) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
+	})
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// ReloadEvery picks up keys added to or removed from the directory so that
+// rotation does not need a restart.
+func (ks *KeySet) ReloadEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ks.Reload(); err != nil {
+			log.Printf("Failed to reload signing keys, keeping the previous set: %v", err)
+		}
+	}
+}
+
+// Current returns the key that signs new tokens.
+func (ks *KeySet) Current() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	var current *SigningKey
+	for _, key := range ks.keys {
+		if key.ActiveFrom.After(now) {
+			break
+		}
+		current = key
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no signing key is active yet")
+	}
+	return current, nil
+}
+
+// Published returns every key that tokens may still be verified with,
+// including keys scheduled for the future so that verifiers can fetch them
+// before they are first used.
+func (ks *KeySet) Published() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	retiredBefore := time.Time{}
+	cutoff := time.Now().Add(-ks.grace)
+	for _, key := range ks.keys {
+		if key.ActiveFrom.After(cutoff) {
+			break
+		}
+		retiredBefore = key.ActiveFrom
+	}
+
+	var keys []*SigningKey
+	for _, key := range ks.keys {
+		if !key.ActiveFrom.Before(retiredBefore) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	for _, key := range ks.Published() {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (ks *KeySet) JWKS() []JWK {
+	var jwks []JWK
+	for _, key := range ks.Published() {
+		jwk := JWK{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	key := &SigningKey{ID: kid, ActiveFrom: activationTime(kid)}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.private = private
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.private = private
+	default:
+		return nil, fmt.Errorf("key %s must be an RSA or Ed25519 private key", path)
+	}
+	return key, nil
+}
+
+func activationTime(kid string) time.Time {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if len(kid) < len(layout) {
+			continue
+		}
+		if t, err := time.Parse(layout, kid[:len(layout)]); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
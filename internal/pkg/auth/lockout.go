@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+// Throttle describes how failed logins for one key are punished: the first
+// FreeAttempts failures cost nothing, every further failure locks the key for
+// BaseDelay doubled per extra failure, up to MaxDelay. Counters start over
+// once no failure happened for ResetAfter.
+type Throttle struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	ResetAfter   time.Duration
+}
+
+var (
+	AccountThrottle = Throttle{FreeAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, ResetAfter: time.Hour}
+	IPThrottle      = Throttle{FreeAttempts: 20, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, ResetAfter: time.Hour}
+)
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LockFor returns how long the key is locked after its failures-th failure.
+func (t Throttle) LockFor(failures int) time.Duration {
+	extra := failures - t.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	delay := t.BaseDelay
+	for i := 1; i < extra; i++ {
+		delay *= 2
+		if delay >= t.MaxDelay {
+			return t.MaxDelay
+		}
+	}
+	return delay
+}
+
+// LoginLockedUntil returns the latest time any of keys is locked until, or
+// the zero time when none of them is locked.
+func LoginLockedUntil(keys ...string) (time.Time, error) {
+	var lockedUntil time.Time
+	for _, key := range keys {
+		until, err := keyLockedUntil(db.DB, key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+	return lockedUntil, nil
+}
+
+// RecordLoginFailure counts a failed attempt against key and returns until
+// when the key is now locked; the zero time means it isn't.
+func RecordLoginFailure(key string, t Throttle) (time.Time, error) {
+	return recordFailure(db.DB, key, t)
+}
+
+// Execer is satisfied by both *sql.DB and *sql.Tx.
+type Execer interface {
+	RowQuerier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func keyLockedUntil(q RowQuerier, key string) (time.Time, error) {
+	var until sql.NullTime
+	err := q.QueryRow(
+		"SELECT locked_until FROM login_throttles WHERE key = $1 AND locked_until > CURRENT_TIMESTAMP", key,
+	).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check login lock: %w", err)
+	}
+	return until.Time, nil
+}
+
+func recordFailure(q Execer, key string, t Throttle) (time.Time, error) {
+	now := time.Now()
+	query := `
+		INSERT INTO login_throttles (
+			key,
+			failures,
+			last_failure_at
+		) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < $3 THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`
+	var failures int
+	err := q.QueryRow(query, key, now, now.Add(-t.ResetAfter)).Scan(&failures)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	delay := t.LockFor(failures)
+	if delay == 0 {
+		return time.Time{}, nil
+	}
+	lockedUntil := now.Add(delay)
+	_, err = q.Exec("UPDATE login_throttles SET locked_until = $1 WHERE key = $2", lockedUntil, key)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock login: %w", err)
+	}
+	return lockedUntil, nil
+}
+
+func ResetLoginFailures(key string) error {
+	_, err := db.DB.Exec("DELETE FROM login_throttles WHERE key = $1", key)
+	return err
+}
+
+// ClientIP returns the address the request came from. X-Forwarded-For is only
+// trusted when TRUST_PROXY_HEADERS=true, since clients can set it freely.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const (
+	mfaAudience        = "mfa"
+	MFAChallengeTTL    = 5 * time.Minute
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 8
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotPending     = errors.New("no multi-factor enrollment in progress")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFAChallengeUsed  = errors.New("MFA token has already been used")
+)
+
+// MFAThrottle limits guessing of second factors. Failures are counted per
+// account rather than per challenge, so logging in again with the password
+// doesn't buy more guesses; only a correct code, an admin unlock or a day
+// without failures starts the count over.
+var MFAThrottle = Throttle{FreeAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: 24 * time.Hour}
+
+// MFALockedError is returned while a user's second factor is locked after too
+// many invalid codes.
+type MFALockedError struct {
+	Until time.Time
+}
+
+func (e *MFALockedError) Error() string {
+	return "too many invalid authentication codes, locked until " + e.Until.Format(time.RFC3339)
+}
+
+func MFAKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+// MFAChallengeClaims is the short-lived token LoginUser hands out instead of
+// an access token when a second factor is needed. Enroll is set when the
+// user's role requires MFA but the user hasn't set it up yet.
+type MFAChallengeClaims struct {
+	UserID int  `json:"user_id"`
+	Enroll bool `json:"enroll,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func GenerateMFAChallenge(userID int, enroll bool) (string, error) {
+	jti, err := NewOpaqueToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := MFAChallengeClaims{
+		userID,
+		enroll,
+		jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return signToken(claims)
+}
+
+func ValidateMFAChallenge(tokenString string) (*MFAChallengeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MFAChallengeClaims{}, verificationKey, jwt.WithAudience(mfaAudience))
+	if err != nil {
+		return nil, fmt.Errorf("token parsing error: %w", err)
+	}
+	// Without a jti the challenge couldn't be used up
+	if claims, ok := token.Claims.(*MFAChallengeClaims); ok && token.Valid && claims.ID != "" {
+		return claims, nil
+	}
+	return nil, fmt.Errorf("invalid or expired MFA token")
+}
+
+type MFAEnrollment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioning_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
+}
+
+// MFAStatus reports whether userID has confirmed MFA and whether their role
+// demands it.
+func MFAStatus(userID int) (bool, bool, error) {
+	query := `
+		SELECT
+			m.enabled_at IS NOT NULL,
+			r.mfa_required
+		FROM users AS u
+		JOIN roles AS r
+		ON u.role = r.name
+		LEFT JOIN user_mfa AS m
+		ON u.id = m.user_id
+		WHERE u.id = $1`
+	var enabled sql.NullBool
+	var required bool
+	if err := db.DB.QueryRow(query, userID).Scan(&enabled, &required); err != nil {
+		return false, false, err
+	}
+	return enabled.Bool, required, nil
+}
+
+// NewMFAEnrollment generates a TOTP secret and recovery codes for account,
+// which the caller stores before handing them to the user.
+func NewMFAEnrollment(account string) (*MFAEnrollment, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(mfaIssuer(), account, secret),
+		RecoveryCodes:   codes,
+	}, nil
+}
+
+// HashRecoveryCode is how recovery codes are stored. Codes typed with other
+// case, spacing or without the dash hash the same.
+func HashRecoveryCode(code string) string {
+	return HashToken(normalizeRecoveryCode(code))
+}
+
+// StartMFAEnrollment creates a new pending secret and recovery codes for
+// userID, replacing any earlier unconfirmed enrollment.
+func StartMFAEnrollment(userID int, account string) (*MFAEnrollment, error) {
+	enrollment, err := NewMFAEnrollment(account)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO user_mfa (
+			user_id,
+			secret
+		) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL`
+	result, err := tx.Exec(query, userID, enrollment.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store MFA secret: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	_, err = tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range enrollment.RecoveryCodes {
+		_, err = tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, HashRecoveryCode(code),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// ConfirmMFAEnrollment turns a pending enrollment on once the user proves
+// their authenticator produces valid codes.
+func ConfirmMFAEnrollment(userID int, code string) error {
+	return attemptMFA(userID, nil, func(tx *sql.Tx) (bool, error) {
+		return confirmEnrollment(tx, userID, code)
+	})
+}
+
+// VerifyMFACode accepts either a current TOTP code or an unused recovery
+// code.
+func VerifyMFACode(userID int, code string) error {
+	return attemptMFA(userID, nil, func(tx *sql.Tx) (bool, error) {
+		return verifyCode(tx, userID, code)
+	})
+}
+
+// CompleteMFAChallenge checks code against the second factor challenge asks
+// for, confirming the enrollment of an Enroll challenge, and uses the
+// challenge up so it can't be exchanged for another session.
+func CompleteMFAChallenge(challenge *MFAChallengeClaims, code string) error {
+	return attemptMFA(challenge.UserID, challenge, func(tx *sql.Tx) (bool, error) {
+		if challenge.Enroll {
+			return confirmEnrollment(tx, challenge.UserID, code)
+		}
+		return verifyCode(tx, challenge.UserID, code)
+	})
+}
+
+// attemptMFA runs check as one attempt at userID's second factor. Attempts of
+// a user are serialized on their user_mfa row and failures count against
+// MFAThrottle, so parallel requests can't slip past the limit either.
+// challenge, when given, is rejected if it was used before and used up when
+// check succeeds.
+func attemptMFA(userID int, challenge *MFAChallengeClaims, check func(tx *sql.Tx) (bool, error)) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lockedUserID int
+	err = tx.QueryRow("SELECT user_id FROM user_mfa WHERE user_id = $1"+db.ForUpdate(), userID).Scan(&lockedUserID)
+	if err == sql.ErrNoRows {
+		return ErrMFANotPending
+	}
+	if err != nil {
+		return err
+	}
+
+	key := MFAKey(userID)
+	lockedUntil, err := keyLockedUntil(tx, key)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		return &MFALockedError{Until: lockedUntil}
+	}
+
+	if challenge != nil {
+		var used bool
+		err = tx.QueryRow("SELECT TRUE FROM revoked_tokens WHERE jti = $1", challenge.ID).Scan(&used)
+		if err == nil {
+			return ErrMFAChallengeUsed
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	ok, err := check(tx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		lockedUntil, err := recordFailure(tx, key, MFAThrottle)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if !lockedUntil.IsZero() {
+			RecordEvent(Event{
+				UserID:  userID,
+				Type:    EventMFALocked,
+				Details: "locked until " + lockedUntil.Format(time.RFC3339),
+			})
+		}
+		return ErrInvalidMFACode
+	}
+
+	if challenge != nil {
+		// Used challenges are kept with the revoked access tokens until they
+		// expire
+		_, err = tx.Exec(
+			"INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)",
+			challenge.ID, userID, challenge.ExpiresAt.Time,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to use up MFA token: %w", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM login_throttles WHERE key = $1", key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func confirmEnrollment(tx *sql.Tx, userID int, code string) (bool, error) {
+	var secret string
+	var enabledAt sql.NullTime
+	err := tx.QueryRow("SELECT secret, enabled_at FROM user_mfa WHERE user_id = $1", userID).Scan(&secret, &enabledAt)
+	if err == sql.ErrNoRows {
+		return false, ErrMFANotPending
+	}
+	if err != nil {
+		return false, err
+	}
+	if enabledAt.Valid {
+		return false, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := MatchTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	_, err = tx.Exec(
+		"UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $1 WHERE user_id = $2",
+		step, userID,
+	)
+	return err == nil, err
+}
+
+func verifyCode(tx *sql.Tx, userID int, code string) (bool, error) {
+	var secret string
+	var lastUsedStep int64
+	query := `
+		SELECT
+			secret,
+			last_used_step
+		FROM user_mfa
+		WHERE user_id = $1 AND enabled_at IS NOT NULL`
+	err := tx.QueryRow(query, userID).Scan(&secret, &lastUsedStep)
+	if err == sql.ErrNoRows {
+		return false, ErrMFANotPending
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := MatchTOTP(secret, code, time.Now()); ok && step > lastUsedStep {
+		_, err = tx.Exec("UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2", step, userID)
+		return err == nil, err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, HashRecoveryCode(code),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ResetMFAAttempts lifts a lock on the user's second factor, e.g. when an
+// admin unlocks the account.
+func ResetMFAAttempts(userID int) error {
+	return ResetLoginFailures(MFAKey(userID))
+}
+
+func DisableMFA(userID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	// Lowercase base32 is easy to read out and type
+	code := strings.ToLower(totpEncoding.EncodeToString(b))
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Fleet Management"
+}
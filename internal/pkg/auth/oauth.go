@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const (
+	ClientTokenTTL = time.Hour
+	clientIDPrefix = "fmc_"
+)
+
+var ErrInvalidClient = errors.New("invalid or revoked client credentials")
+
+// OAuthClient is a registered client of the client_credentials grant. It
+// acts as UserID with that user's current role, limited to Scopes.
+type OAuthClient struct {
+	ID       int
+	ClientID string
+	UserID   int
+	Role     string
+	Scopes   []string
+}
+
+// CreateOAuthClient registers a client acting as userID and returns its ID,
+// client_id and secret. The secret can't be recovered later.
+func CreateOAuthClient(name string, userID int, scopes []string) (int, string, string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return 0, "", "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	clientID := clientIDPrefix + hex.EncodeToString(b)
+	secret, err := NewOpaqueToken(32)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `
+		INSERT INTO oauth_clients (
+			client_id,
+			secret_hash,
+			name,
+			user_id
+		) VALUES ($1, $2, $3, $4)
+		RETURNING id`
+	err = tx.QueryRow(query, clientID, HashToken(secret), name, userID).Scan(&id)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to store OAuth client: %w", err)
+	}
+
+	for _, scope := range scopes {
+		_, err = tx.Exec(
+			"INSERT INTO oauth_client_scopes (client_id, permission_id) SELECT $1, id FROM permissions WHERE name = $2 ON CONFLICT DO NOTHING",
+			id, scope,
+		)
+		if err != nil {
+			return 0, "", "", fmt.Errorf("failed to store OAuth client scope: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", err
+	}
+	return id, clientID, secret, nil
+}
+
+// AuthenticateOAuthClient checks a client's credentials and returns the
+// client with its allowed scopes.
+func AuthenticateOAuthClient(clientID, secret string) (*OAuthClient, error) {
+	query := `
+		SELECT
+			c.id,
+			c.secret_hash,
+			c.user_id,
+			u.role
+		FROM oauth_clients AS c
+		JOIN users AS u
+		ON c.user_id = u.id
+		WHERE c.client_id = $1 AND c.revoked_at IS NULL`
+	client := OAuthClient{ClientID: clientID}
+	var secretHash string
+	err := db.DB.QueryRow(query, clientID).Scan(&client.ID, &secretHash, &client.UserID, &client.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(HashToken(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	client.Scopes, err = OAuthClientScopes(client.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func OAuthClientScopes(id int) ([]string, error) {
+	query := `
+		SELECT
+			p.name
+		FROM oauth_client_scopes AS s
+		JOIN permissions AS p
+		ON s.permission_id = p.id
+		WHERE s.client_id = $1
+		ORDER BY p.name ASC`
+	rows, err := db.DB.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OAuth client scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := []string{}
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
+
+// OAuthClientActive reports whether clientID exists and hasn't been revoked,
+// so that revoking a client also invalidates the tokens it already holds.
+func OAuthClientActive(clientID string) (bool, error) {
+	var active bool
+	err := db.DB.QueryRow(
+		"SELECT revoked_at IS NULL FROM oauth_clients WHERE client_id = $1", clientID,
+	).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
+
+// GenerateClientToken issues an access token with the same claims as a user
+// login, plus the client ID and the granted scopes.
+func GenerateClientToken(client *OAuthClient, scopes []string) (string, error) {
+	claims, err := newAccessClaims(client.UserID, client.Role, ClientTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.ClientID = client.ClientID
+	claims.Scope = strings.Join(scopes, " ")
+	return signToken(claims)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// RowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type RowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// IssueOneTimeToken creates a token for userID that can be consumed once for
+// purpose within ttl. Earlier unused tokens for the same purpose stop working
+// so that only the most recent email is valid.
+func IssueOneTimeToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := NewOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate previous tokens: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_tokens (
+			user_id,
+			purpose,
+			token_hash,
+			expires_at
+		) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(query, userID, purpose, HashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeOneTimeToken marks token as used and returns the user it was issued
+// to. Pass a transaction to make consuming it part of a larger change.
+func ConsumeOneTimeToken(q RowQuerier, token, purpose string) (int, error) {
+	query := `
+		UPDATE user_tokens
+		SET
+			used_at = CURRENT_TIMESTAMP
+		WHERE
+			token_hash = $1 AND
+			purpose = $2 AND
+			used_at IS NULL AND
+			expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`
+	var userID int
+	err := q.QueryRow(query, HashToken(token), purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidOneTimeToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const permissionsChannel = "role_permissions_changed"
+
+// PermissionResolver looks up the permissions granted to a role in the
+// roles/role_permissions tables and caches them per role. Entries are dropped
+// when Postgres reports a change through NOTIFY and, as a fallback for missed
+// notifications, once they are older than ttl.
+type PermissionResolver struct {
+	ttl time.Duration
+
+	mu    sync.RWMutex
+	roles map[string]cachedRole
+	// Invalidating bumps the role's generation, or allGeneration for every
+	// role, so that a lookup that read the database before the change doesn't
+	// cache what it read
+	generations   map[string]uint64
+	allGeneration uint64
+}
+
+type cachedRole struct {
+	permissions map[string]struct{}
+	loadedAt    time.Time
+}
+
+var Permissions = NewPermissionResolver(5 * time.Minute)
+
+func NewPermissionResolver(ttl time.Duration) *PermissionResolver {
+	return &PermissionResolver{
+		ttl:         ttl,
+		roles:       make(map[string]cachedRole),
+		generations: make(map[string]uint64),
+	}
+}
+
+func (p *PermissionResolver) HasPermission(role, permission string) (bool, error) {
+	permissions, err := p.resolve(role)
+	if err != nil {
+		return false, err
+	}
+	_, ok := permissions[permission]
+	return ok, nil
+}
+
+// RolePermissions returns the permission names currently granted to role.
+func (p *PermissionResolver) RolePermissions(role string) ([]string, error) {
+	permissions, err := p.resolve(role)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(permissions))
+	for name := range permissions {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (p *PermissionResolver) Invalidate(role string) {
+	p.mu.Lock()
+	delete(p.roles, role)
+	p.generations[role]++
+	p.mu.Unlock()
+}
+
+func (p *PermissionResolver) InvalidateAll() {
+	p.mu.Lock()
+	p.roles = make(map[string]cachedRole)
+	p.allGeneration++
+	p.mu.Unlock()
+}
+
+// generation changes whenever role is invalidated. p.mu must be held.
+func (p *PermissionResolver) generation(role string) uint64 {
+	return p.generations[role] + p.allGeneration
+}
+
+// Listen subscribes to role permission changes so that every API instance
+// drops its cached copy as soon as role_permissions is modified.
+func (p *PermissionResolver) Listen(connStr string) error {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Permission listener: %v", err)
+		}
+	})
+	if err := listener.Listen(permissionsChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen for permission changes: %w", err)
+	}
+
+	go func() {
+		for n := range listener.Notify {
+			// A nil notification means the connection was re-established
+			// and changes may have been missed in between.
+			if n == nil || n.Extra == "*" {
+				p.InvalidateAll()
+				continue
+			}
+			p.Invalidate(n.Extra)
+		}
+	}()
+	return nil
+}
+
+func (p *PermissionResolver) resolve(role string) (map[string]struct{}, error) {
+	p.mu.RLock()
+	cached, ok := p.roles[role]
+	generation := p.generation(role)
+	p.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < p.ttl {
+		return cached.permissions, nil
+	}
+
+	query := `
+		SELECT
+			p.name
+		FROM roles AS r
+		JOIN role_permissions AS rp
+		ON r.id = rp.role_id
+		JOIN permissions AS p
+		ON rp.permission_id = p.id
+		WHERE r.name = $1`
+	rows, err := db.DB.Query(query, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions of role %s: %w", role, err)
+	}
+	defer rows.Close()
+
+	permissions := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// What was read still answers this lookup, but may predate a change made
+	// in the meantime
+	p.mu.Lock()
+	if p.generation(role) == generation {
+		p.roles[role] = cachedRole{permissions: permissions, loadedAt: time.Now()}
+	}
+	p.mu.Unlock()
+	return permissions, nil
+}
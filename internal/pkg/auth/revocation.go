@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+// RevocationStore answers whether an access token has been revoked. The
+// revoked_tokens and user_token_revocations tables and sessions.revoked_at are
+// the source of truth; they are mirrored in memory and reloaded once the copy
+// is older than ttl, so other API instances pick up revocations within that
+// window.
+type RevocationStore struct {
+	ttl time.Duration
+
+	mu          sync.RWMutex
+	loadedAt    time.Time
+	tokens      map[string]time.Time
+	userCutoffs map[int]time.Time
+	sessions    map[string]bool
+}
+
+var Revocations = NewRevocationStore(30 * time.Second)
+
+func NewRevocationStore(ttl time.Duration) *RevocationStore {
+	return &RevocationStore{
+		ttl:         ttl,
+		tokens:      make(map[string]time.Time),
+		userCutoffs: make(map[int]time.Time),
+		sessions:    make(map[string]bool),
+	}
+}
+
+func (s *RevocationStore) IsRevoked(claims *UserClaims) (bool, error) {
+	if err := s.reloadIfStale(); err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if claims.ID != "" {
+		if _, ok := s.tokens[claims.ID]; ok {
+			return true, nil
+		}
+	}
+	if claims.SessionID != "" && s.sessions[claims.SessionID] {
+		return true, nil
+	}
+	// Revoking the admin behind an impersonation token ends the impersonation
+	// too
+	userIDs := []int{claims.UserID}
+	if claims.Act != nil {
+		userIDs = append(userIDs, claims.Act.UserID)
+	}
+	for _, userID := range userIDs {
+		if cutoff, ok := s.userCutoffs[userID]; ok {
+			if claims.IssuedAt == nil || claims.IssuedAt.Before(cutoff) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// RevokeToken rejects a single access token until it expires.
+func (s *RevocationStore) RevokeToken(claims *UserClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("token has no jti or expiry and cannot be revoked individually")
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (
+			jti,
+			user_id,
+			expires_at
+		) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`
+	_, err := db.DB.Exec(query, claims.ID, claims.UserID, claims.ExpiresAt.Time)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	s.mu.Lock()
+	s.tokens[claims.ID] = claims.ExpiresAt.Time
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUser rejects every token issued to userID before the current second.
+// Tokens carry their issue time in whole seconds, so one issued later in the
+// same second, such as by logging in again right away, stays valid.
+func (s *RevocationStore) RevokeUser(userID int) error {
+	cutoff, err := storeUserCutoff(db.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.userCutoffs[userID] = cutoff
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeUserTx does what RevokeUser and RevokeUserSessions do in tx, for
+// revoking a user along with other changes. The function it returns makes the
+// revocation take effect on this instance and is to be called once tx has
+// committed.
+func (s *RevocationStore) RevokeUserTx(tx *sql.Tx, userID int) (func(), error) {
+	cutoff, err := storeUserCutoff(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL RETURNING id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+	defer rows.Close()
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.userCutoffs[userID] = cutoff
+		for _, id := range sessionIDs {
+			s.sessions[id] = true
+		}
+	}, nil
+}
+
+func storeUserCutoff(e Execer, userID int) (time.Time, error) {
+	cutoff := time.Now().Truncate(time.Second)
+
+	query := `
+		INSERT INTO user_token_revocations (
+			user_id,
+			revoked_before
+		) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = EXCLUDED.revoked_before`
+	_, err := e.Exec(query, userID, cutoff)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return cutoff, nil
+}
+
+// Prune deletes revoked tokens that have expired, which can no longer match a
+// valid token.
+func (s *RevocationStore) Prune() error {
+	if _, err := db.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+		return fmt.Errorf("failed to prune revoked tokens: %w", err)
+	}
+	return nil
+}
+
+// PruneEvery calls Prune every interval. It doesn't return.
+func (s *RevocationStore) PruneEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Prune(); err != nil {
+			log.Printf("Failed to prune revoked tokens: %v", err)
+		}
+	}
+}
+
+// sessionEnded is called once a session's revoked_at has been set, so that
+// this instance doesn't wait for the next reload to reject its tokens.
+func (s *RevocationStore) sessionEnded(sessionID string) {
+	s.mu.Lock()
+	s.sessions[sessionID] = true
+	s.mu.Unlock()
+}
+
+func (s *RevocationStore) reloadIfStale() error {
+	s.mu.RLock()
+	fresh := time.Since(s.loadedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.loadedAt) < s.ttl {
+		return nil
+	}
+
+	tokens := make(map[string]time.Time)
+	rows, err := db.DB.Query("SELECT jti, expires_at FROM revoked_tokens")
+	if err != nil {
+		return fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan revoked token: %w", err)
+		}
+		tokens[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	userCutoffs := make(map[int]time.Time)
+	cutoffRows, err := db.DB.Query("SELECT user_id, revoked_before FROM user_token_revocations")
+	if err != nil {
+		return fmt.Errorf("failed to load user revocations: %w", err)
+	}
+	defer cutoffRows.Close()
+	for cutoffRows.Next() {
+		var userID int
+		var revokedBefore time.Time
+		if err := cutoffRows.Scan(&userID, &revokedBefore); err != nil {
+			return fmt.Errorf("failed to scan user revocation: %w", err)
+		}
+		userCutoffs[userID] = revokedBefore
+	}
+	if err := cutoffRows.Err(); err != nil {
+		return err
+	}
+
+	// Access tokens of sessions ended longer ago than their lifetime have
+	// expired on their own
+	sessions := make(map[string]bool)
+	sessionRows, err := db.DB.Query("SELECT id FROM sessions WHERE revoked_at > $1", time.Now().Add(-AccessTokenTTL))
+	if err != nil {
+		return fmt.Errorf("failed to load ended sessions: %w", err)
+	}
+	defer sessionRows.Close()
+	for sessionRows.Next() {
+		var sessionID string
+		if err := sessionRows.Scan(&sessionID); err != nil {
+			return fmt.Errorf("failed to scan ended session: %w", err)
+		}
+		sessions[sessionID] = true
+	}
+	if err := sessionRows.Err(); err != nil {
+		return err
+	}
+
+	s.tokens = tokens
+	s.userCutoffs = userCutoffs
+	s.sessions = sessions
+	s.loadedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// NewOpaqueToken returns a random URL-safe token of n bytes of entropy.
+func NewOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is how opaque tokens are stored; the plain value is only ever
+// handed to the client.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a new token family for userID and returns its ID along
+// with the first refresh token. userAgent and ip describe the device the user
+// logged in from.
+func CreateSession(userID int, userAgent, ip string) (string, string, error) {
+	sessionID, err := NewOpaqueToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := NewOpaqueToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	expiresAt := time.Now().Add(RefreshTokenTTL)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (
+			id,
+			user_id,
+			expires_at,
+			user_agent,
+			ip_address
+		) VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.Exec(query, sessionID, userID, expiresAt, truncate(userAgent, maxUserAgentLength), ip)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		sessionID, HashToken(refreshToken), expiresAt,
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+	return sessionID, refreshToken, nil
+}
+
+// RotateRefreshToken consumes refreshToken and issues its successor in the
+// same session. Presenting a token that was already consumed revokes the
+// whole session, since either the client or an attacker holds a stolen copy.
+func RotateRefreshToken(refreshToken string) (int, string, string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT
+			rt.id,
+			rt.session_id,
+			rt.expires_at,
+			rt.used_at,
+			s.user_id,
+			s.revoked_at
+		FROM refresh_tokens AS rt
+		JOIN sessions AS s
+		ON rt.session_id = s.id
+		WHERE rt.token_hash = $1` + db.ForUpdate()
+	var tokenID, userID int
+	var sessionID string
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(query, HashToken(refreshToken)).Scan(
+		&tokenID, &sessionID, &expiresAt, &usedAt, &userID, &revokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return 0, "", "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if usedAt.Valid {
+		_, err = tx.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL", sessionID)
+		if err != nil {
+			return 0, "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", "", err
+		}
+		Revocations.sessionEnded(sessionID)
+		return 0, "", "", ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return 0, "", "", ErrInvalidRefreshToken
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenID)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	newToken, err := NewOpaqueToken(32)
+	if err != nil {
+		return 0, "", "", err
+	}
+	newExpiresAt := time.Now().Add(RefreshTokenTTL)
+
+	_, err = tx.Exec(
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		sessionID, HashToken(newToken), newExpiresAt,
+	)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	_, err = tx.Exec("UPDATE sessions SET expires_at = $1 WHERE id = $2", newExpiresAt, sessionID)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", err
+	}
+	return userID, sessionID, newToken, nil
+}
+
+// RevokeSessionByRefreshToken ends the session that refreshToken belongs to.
+// Unknown tokens are ignored so logging out twice is harmless.
+func RevokeSessionByRefreshToken(refreshToken string) error {
+	query := `
+		UPDATE sessions
+		SET
+			revoked_at = CURRENT_TIMESTAMP
+		WHERE
+			revoked_at IS NULL AND id = (
+				SELECT session_id FROM refresh_tokens WHERE token_hash = $1
+			)
+		RETURNING id`
+	return endSessions(query, HashToken(refreshToken))
+}
+
+// RevokeUserSessions ends every active session of userID.
+func RevokeUserSessions(userID int) error {
+	return endSessions("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL RETURNING id", userID)
+}
+
+// RevokeOtherSessions ends every active session of userID except keep, e.g.
+// after a password change made from the session being kept.
+func RevokeOtherSessions(userID int, keep string) error {
+	return endSessions(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id",
+		userID, keep,
+	)
+}
+
+// EndSession ends one session of userID. It reports false when userID has no
+// such active session.
+func EndSession(userID int, sessionID string) (bool, error) {
+	var id string
+	err := db.DB.QueryRow(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL RETURNING id",
+		sessionID, userID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	Revocations.sessionEnded(id)
+	return true, nil
+}
+
+// endSessions runs an UPDATE returning the IDs of the sessions it ended and
+// makes their access tokens stop working on this instance right away.
+func endSessions(query string, args ...interface{}) error {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		Revocations.sessionEnded(id)
+	}
+	return rows.Err()
+}
+
+const maxUserAgentLength = 512
+
+// truncate shortens s to at most n bytes of valid UTF-8, which is all the
+// database accepts. Header values may hold any bytes, so invalid ones are
+// dropped, and s is only cut at the start of a character.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ActivityTracker records when sessions were last used. Writing on every
+// request would be wasteful, so a session is only updated once per interval
+// by each API instance.
+type ActivityTracker struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var SessionActivity = NewActivityTracker(time.Minute)
+
+func NewActivityTracker(interval time.Duration) *ActivityTracker {
+	return &ActivityTracker{interval: interval, seen: make(map[string]time.Time)}
+}
+
+// Touch marks sessionID as seen now from ip.
+func (a *ActivityTracker) Touch(sessionID, ip string) error {
+	now := time.Now()
+
+	a.mu.Lock()
+	if last, ok := a.seen[sessionID]; ok && now.Sub(last) < a.interval {
+		a.mu.Unlock()
+		return nil
+	}
+	a.seen[sessionID] = now
+	// Forget sessions that haven't been used for a while so the map doesn't
+	// grow with every session ever seen
+	if len(a.seen) > 10000 {
+		for id, last := range a.seen {
+			if now.Sub(last) >= a.interval {
+				delete(a.seen, id)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	_, err := db.DB.Exec("UPDATE sessions SET last_seen_at = $1, ip_address = $2 WHERE id = $3", now, ip, sessionID)
+	return err
+}
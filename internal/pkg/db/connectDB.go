@@ -5,28 +5,43 @@ import (
 	"fmt"
 	"log"
 	"os"
-
-	_ "github.com/lib/pq"
 )
 
 var DB *sql.DB
 
+// ConnectDB opens the database named by DB_CONNECTION_STRING, Postgres or
+// SQLite depending on its scheme.
 func ConnectDB() error {
 	connStr := os.Getenv("DB_CONNECTION_STRING")
 	if connStr == "" {
 		log.Fatal("Error: DB_CONNECTION_STRING environment variable not set.")
 	}
 	var err error
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = Open(connStr)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
+		return err
 	}
 
-	err = DB.Ping()
+	fmt.Printf("Successfully connected to %s!\n", Current)
+	return nil
+}
+
+// Open connects to connStr and makes its dialect the current one. It
+// doesn't touch DB.
+func Open(connStr string) (*sql.DB, error) {
+	dialect, driverName, dataSource := parseConnectionString(connStr)
+
+	conn, err := sql.Open(driverName, dataSource)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	fmt.Println("Successfully connected to PostgreSQL!")
-	return nil
+	err = conn.Ping()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	Current = dialect
+	return conn, nil
 }
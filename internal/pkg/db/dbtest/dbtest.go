@@ -0,0 +1,79 @@
+// Package dbtest points db.DB at the databases integration tests run
+// against.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+	"github.com/kwagmire/fleet-management-api/migrations"
+)
+
+var (
+	postgresOnce sync.Once
+	postgresDB   *sql.DB
+	postgresErr  error
+)
+
+// Each runs test once on a fresh SQLite database and, given one as
+// TEST_DB_CONNECTION_STRING, once on a PostgreSQL database it may migrate
+// and write to. The PostgreSQL database is shared by every test, so tests
+// shouldn't expect it to be empty.
+func Each(t *testing.T, test func(t *testing.T)) {
+	t.Run("sqlite", func(t *testing.T) {
+		Fresh(t)
+		test(t)
+	})
+
+	connStr := os.Getenv("TEST_DB_CONNECTION_STRING")
+	if connStr == "" {
+		return
+	}
+	t.Run("postgres", func(t *testing.T) {
+		postgresOnce.Do(func() {
+			postgresDB, postgresErr = open(connStr)
+		})
+		if postgresErr != nil {
+			t.Fatalf("failed to set up test database: %v", postgresErr)
+		}
+		use(t, postgresDB, db.Postgres)
+		test(t)
+	})
+}
+
+// Fresh points db.DB at a new, migrated SQLite database until t ends.
+func Fresh(t testing.TB) {
+	t.Helper()
+	conn, err := open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to set up test database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	use(t, conn, db.SQLite)
+}
+
+func open(connStr string) (*sql.DB, error) {
+	conn, err := db.Open(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrations.Up(context.Background(), conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// use swaps db.DB for conn until t ends.
+func use(t testing.TB, conn *sql.DB, dialect db.Dialect) {
+	previousDB, previousDialect := db.DB, db.Current
+	db.DB, db.Current = conn, dialect
+	t.Cleanup(func() {
+		db.DB, db.Current = previousDB, previousDialect
+	})
+}
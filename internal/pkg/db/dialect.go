@@ -0,0 +1,70 @@
+package db
+
+import (
+	"net/url"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// Dialect is the kind of database behind DB.
+type Dialect string
+
+const (
+	Postgres Dialect = "PostgreSQL"
+	SQLite   Dialect = "SQLite"
+)
+
+// Current is the dialect of the last database opened.
+var Current = Postgres
+
+// ForUpdate is appended to a SELECT in a transaction to lock the rows it
+// reads. SQLite has no row locks; its transactions begin IMMEDIATE instead,
+// which holds the database's write lock from the start and serializes them
+// just the same.
+func ForUpdate() string {
+	if Current == SQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// sqlitePragmas are applied to every SQLite connection: enforce foreign keys
+// like Postgres does, wait for the write lock instead of failing straight
+// away, and let readers carry on while a transaction writes.
+var sqlitePragmas = []string{
+	"foreign_keys(1)",
+	"busy_timeout(5000)",
+	"journal_mode(WAL)",
+}
+
+// parseConnectionString picks the dialect from the scheme of connStr:
+// sqlite://path, sqlite:path or file:path open a SQLite database, anything
+// else (postgres://... or key=value pairs) is handed to lib/pq.
+func parseConnectionString(connStr string) (Dialect, string, string) {
+	var path string
+	switch {
+	case strings.HasPrefix(connStr, "sqlite://"):
+		path = strings.TrimPrefix(connStr, "sqlite://")
+	case strings.HasPrefix(connStr, "sqlite:"):
+		path = strings.TrimPrefix(connStr, "sqlite:")
+	case strings.HasPrefix(connStr, "file:"):
+		path = strings.TrimPrefix(connStr, "file:")
+	default:
+		return Postgres, "postgres", connStr
+	}
+
+	path, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		query = url.Values{}
+	}
+	for _, pragma := range sqlitePragmas {
+		query.Add("_pragma", pragma)
+	}
+	query.Set("_txlock", "immediate")
+	// Store times as text the sqlite3 shell can read, and that compares
+	// correctly with CURRENT_TIMESTAMP
+	query.Set("_time_format", "sqlite")
+	return SQLite, sqliteDriverName, "file:" + path + "?" + query.Encode()
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName is modernc.org/sqlite with every time argument converted
+// to UTC. SQLite keeps times as text, which only compares correctly with
+// CURRENT_TIMESTAMP and other stored times when they share its UTC offset.
+// Reading them back needs nothing: text without an offset parses as UTC.
+const sqliteDriverName = "sqlite-utc"
+
+func init() {
+	sql.Register(sqliteDriverName, utcDriver{&sqlite.Driver{}})
+}
+
+type utcDriver struct {
+	driver *sqlite.Driver
+}
+
+func (d utcDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{conn.(sqliteConn)}, nil
+}
+
+// sqliteConn is what database/sql uses of a modernc.org/sqlite connection.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type utcConn struct {
+	sqliteConn
+}
+
+// CheckNamedValue converts arguments like database/sql would by default,
+// then moves times to UTC. It applies to statements run on the connection as
+// well as to prepared ones.
+func (utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC()
+	}
+	nv.Value = value
+	return nil
+}
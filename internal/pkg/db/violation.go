@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// ViolationKind names a kind of constraint violation after its Postgres
+// error code.
+type ViolationKind string
+
+const (
+	UniqueViolation     ViolationKind = "unique_violation"
+	ForeignKeyViolation ViolationKind = "foreign_key_violation"
+	CheckViolation      ViolationKind = "check_violation"
+	NotNullViolation    ViolationKind = "not_null_violation"
+	ValueTooLong        ViolationKind = "string_data_right_truncation"
+)
+
+// Violation is a constraint violation reported by either database.
+// Constraint is the constraint's name on Postgres. SQLite only names CHECK
+// constraints and reports the columns of the others instead, as
+// "table.column".
+type Violation struct {
+	Kind       ViolationKind
+	Constraint string
+}
+
+// SQLite extended result codes of constraint violations
+const (
+	sqliteConstraintCheck      = 275
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintNotNull    = 1299
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// AsViolation reports whether err is a constraint violation, and which.
+func AsViolation(err error) (Violation, bool) {
+	var pqError *pq.Error
+	if errors.As(err, &pqError) {
+		return Violation{Kind: ViolationKind(pqError.Code.Name()), Constraint: pqError.Constraint}, true
+	}
+
+	var sqliteError *sqlite.Error
+	if !errors.As(err, &sqliteError) {
+		return Violation{}, false
+	}
+	// The message ends with what failed and the code, e.g. "UNIQUE
+	// constraint failed: users.email (2067)"
+	var constraint string
+	message := sqliteError.Error()
+	if i := strings.LastIndex(message, "constraint failed: "); i >= 0 {
+		constraint, _, _ = strings.Cut(message[i+len("constraint failed: "):], " (")
+	}
+	switch sqliteError.Code() {
+	case sqliteConstraintUnique, sqliteConstraintPrimaryKey:
+		return Violation{Kind: UniqueViolation, Constraint: constraint}, true
+	case sqliteConstraintForeignKey:
+		return Violation{Kind: ForeignKeyViolation}, true
+	case sqliteConstraintNotNull:
+		return Violation{Kind: NotNullViolation, Constraint: constraint}, true
+	case sqliteConstraintCheck:
+		// SQLite doesn't enforce VARCHAR lengths, so the SQLite migrations
+		// check them with constraints named after the column
+		if strings.HasSuffix(constraint, "_length") {
+			return Violation{Kind: ValueTooLong, Constraint: constraint}, true
+		}
+		return Violation{Kind: CheckViolation, Constraint: constraint}, true
+	}
+	return Violation{}, false
+}
+
+// IsViolation reports whether err is a constraint violation of the given
+// kind.
+func IsViolation(err error, kind ViolationKind) bool {
+	violation, ok := AsViolation(err)
+	return ok && violation.Kind == kind
+}
@@ -1,6 +1,9 @@
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type Vehicle struct {
 	ID           int            `json:"id"`
@@ -34,3 +37,107 @@ type Driver struct {
 	VehicleYear         sql.NullInt64  `json:"vehicle_year"`
 	VehicleLicensePlate sql.NullString `json:"vehicle_license_plate"`
 }
+
+type Role struct {
+	ID               int      `json:"id"`
+	Name             string   `json:"name"`
+	IsSystem         bool     `json:"is_system"`
+	SelfRegistration bool     `json:"self_registration"`
+	MFARequired      bool     `json:"mfa_required"`
+	Permissions      []string `json:"permissions"`
+}
+
+type Permission struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	IsSystem bool   `json:"is_system"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type OAuthClient struct {
+	ID        int        `json:"id"`
+	ClientID  string     `json:"client_id"`
+	Name      string     `json:"name"`
+	UserID    int        `json:"user_id"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Profile is what GET /me returns. Driver and Owner are only set for users
+// of those roles.
+type Profile struct {
+	ID            int            `json:"id"`
+	Fullname      string         `json:"fullname"`
+	Email         string         `json:"email"`
+	Role          string         `json:"role"`
+	EmailVerified bool           `json:"email_verified"`
+	Driver        *DriverProfile `json:"driver,omitempty"`
+	Owner         *OwnerProfile  `json:"owner,omitempty"`
+}
+
+type DriverProfile struct {
+	LicenseID string           `json:"license_id"`
+	Assigned  bool             `json:"assigned"`
+	Vehicle   *AssignedVehicle `json:"vehicle"`
+}
+
+type AssignedVehicle struct {
+	ID           int    `json:"id"`
+	Make         string `json:"make"`
+	Model        string `json:"model"`
+	Year         int    `json:"year"`
+	LicensePlate string `json:"license_plate"`
+	Status       string `json:"status"`
+}
+
+type OwnerProfile struct {
+	FleetSize int `json:"fleet_size"`
+}
+
+// VehicleStatusTransition is one recorded change of a vehicle's status.
+// ActorID is nil when the database made the change.
+type VehicleStatusTransition struct {
+	ID         int       `json:"id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    *int      `json:"actor_id"`
+	ActorName  *string   `json:"actor_name"`
+	Reason     *string   `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// VehicleAssignment is one period during which a driver had a vehicle.
+// EndedAt is nil for the current assignment, VehicleID once the vehicle has
+// been deleted.
+type VehicleAssignment struct {
+	ID           int        `json:"id"`
+	VehicleID    *int       `json:"vehicle_id"`
+	LicensePlate string     `json:"license_plate"`
+	DriverID     int        `json:"driver_id"`
+	DriverName   string     `json:"driver_name"`
+	AssignedBy   *int       `json:"assigned_by"`
+	UnassignedBy *int       `json:"unassigned_by"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+}
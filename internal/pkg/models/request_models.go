@@ -23,3 +23,89 @@ type AddVehicleRequest struct {
 type AssignRequest struct {
 	DriverID string `json:"driver_id"`
 }
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type CreateRoleRequest struct {
+	Name             string `json:"name"`
+	SelfRegistration bool   `json:"self_registration"`
+}
+
+type CreatePermissionRequest struct {
+	Name string `json:"name"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type RoleMFARequest struct {
+	Required bool `json:"required"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name   string   `json:"name"`
+	UserID int      `json:"user_id"`
+	Scopes []string `json:"scopes"`
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// UpdateProfileRequest only changes the fields that are present.
+// CurrentPassword is required to change the email or the password.
+type UpdateProfileRequest struct {
+	Fullname        *string `json:"fullname,omitempty"`
+	Email           *string `json:"email,omitempty"`
+	NewPassword     *string `json:"new_password,omitempty"`
+	LicenseID       *string `json:"license_id,omitempty"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+// UpdateVehicleRequest only changes the fields that are present.
+type UpdateVehicleRequest struct {
+	Make         *string `json:"make,omitempty"`
+	Model        *string `json:"model,omitempty"`
+	Year         *int    `json:"year,omitempty"`
+	LicensePlate *string `json:"license_plate,omitempty"`
+}
+
+type UpdateVehicleStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,87 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MinLength = 8
+	// MaxLength bounds the work a single login can cause
+	MaxLength = 256
+	// Shorter name or email parts would reject too many good passwords
+	minPersonalLength = 3
+)
+
+var (
+	ErrTooShort     = fmt.Errorf("password must be at least %d characters long", MinLength)
+	ErrTooLong      = fmt.Errorf("password must be at most %d characters long", MaxLength)
+	ErrBreached     = errors.New("password is too common, it appears in known data breaches")
+	ErrPersonalInfo = errors.New("password must not contain your name or email address")
+)
+
+//go:embed breached_passwords.txt
+var breachedList string
+
+var breached = loadBreached(breachedList)
+
+func loadBreached(list string) map[string]bool {
+	set := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = true
+	}
+	return set
+}
+
+// Check validates a new password for the user with the given name and email.
+// The returned errors are meant to be shown to the user.
+func Check(password, name, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length < MinLength {
+		return ErrTooShort
+	}
+	if length > MaxLength {
+		return ErrTooLong
+	}
+
+	lower := strings.ToLower(password)
+	if breached[lower] {
+		return ErrBreached
+	}
+
+	for _, part := range personalParts(name, email) {
+		if strings.Contains(lower, part) {
+			return ErrPersonalInfo
+		}
+	}
+	return nil
+}
+
+// personalParts returns the words of the name and of the email's local part
+// that are long enough to be meaningful in a password.
+func personalParts(name, email string) []string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	words := strings.FieldsFunc(strings.ToLower(name)+" "+local, func(r rune) bool {
+		return r == ' ' || r == '.' || r == '_' || r == '-' || r == '+'
+	})
+	if local != "" {
+		words = append(words, local)
+	}
+
+	parts := make([]string, 0, len(words))
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= minPersonalLength {
+			parts = append(parts, word)
+		}
+	}
+	return parts
+}
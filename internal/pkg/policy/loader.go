@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
+)
+
+// DBLoader reads resource facts from the main database.
+type DBLoader struct{}
+
+func (DBLoader) LoadVehicle(ctx context.Context, id int) (Facts, error) {
+	var ownerID, driverID sql.NullInt64
+	err := db.DB.QueryRowContext(ctx, "SELECT owner_id, driver_id FROM vehicles WHERE id = $1", id).Scan(&ownerID, &driverID)
+	if err == sql.ErrNoRows {
+		return Facts{}, ErrNotFound
+	}
+	if err != nil {
+		return Facts{}, err
+	}
+	return Facts{OwnerID: int(ownerID.Int64), DriverID: int(driverID.Int64)}, nil
+}
+
+func (DBLoader) LoadDriver(ctx context.Context, userID int) (Facts, error) {
+	var driverID int
+	err := db.DB.QueryRowContext(ctx, "SELECT user_id FROM drivers WHERE user_id = $1", userID).Scan(&driverID)
+	if err == sql.ErrNoRows {
+		return Facts{}, ErrNotFound
+	}
+	if err != nil {
+		return Facts{}, err
+	}
+	return Facts{DriverID: driverID}, nil
+}
+
+func (DBLoader) LoadOwner(ctx context.Context, userID int) (Facts, error) {
+	var ownerID int
+	err := db.DB.QueryRowContext(ctx, "SELECT user_id FROM vehicle_owners WHERE user_id = $1", userID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return Facts{}, ErrNotFound
+	}
+	if err != nil {
+		return Facts{}, err
+	}
+	return Facts{OwnerID: ownerID}, nil
+}
+
+// AuthorizeClaims is Authorize for the caller the claims describe.
+func (e *Engine) AuthorizeClaims(ctx context.Context, claims *auth.UserClaims, action Action, resource Resource) error {
+	return e.Authorize(ctx, Subject{
+		UserID: claims.UserID,
+		Role:   claims.Role,
+		Scoped: claims.Scoped(),
+		Scopes: claims.Scopes,
+
+		Impersonated: claims.Act != nil,
+	}, action, resource)
+}
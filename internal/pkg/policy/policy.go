@@ -0,0 +1,236 @@
+// Package policy decides whether a user may perform an action on a specific
+// vehicle, driver or owner. auth.Authenticator.RequirePermission only knows
+// whether a role holds a permission; the rules here add who the resource
+// belongs to.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kwagmire/fleet-management-api/internal/pkg/auth"
+)
+
+var (
+	ErrNotFound  = errors.New("resource not found")
+	ErrForbidden = errors.New("forbidden")
+)
+
+type Action string
+
+const (
+	ReadVehicle     Action = "vehicle:read"
+	UpdateVehicle   Action = "vehicle:update"
+	DeleteVehicle   Action = "vehicle:delete"
+	AssignDriver    Action = "vehicle:assign_driver"
+	ReadAssignments Action = "vehicle:read_assignments"
+
+	ReadDriver   Action = "driver:read"
+	UpdateDriver Action = "driver:update"
+	DeleteDriver Action = "driver:delete"
+
+	CreateVehicle Action = "owner:create_vehicle"
+	ReadOwner     Action = "owner:read"
+	UpdateOwner   Action = "owner:update"
+	DeleteOwner   Action = "owner:delete"
+)
+
+type Kind string
+
+const (
+	KindVehicle Kind = "vehicle"
+	KindDriver  Kind = "driver"
+	KindOwner   Kind = "owner"
+)
+
+type Resource struct {
+	Kind Kind
+	ID   int
+}
+
+func Vehicle(id int) Resource    { return Resource{KindVehicle, id} }
+func Driver(userID int) Resource { return Resource{KindDriver, userID} }
+func Owner(userID int) Resource  { return Resource{KindOwner, userID} }
+
+// Subject is who is asking. When Scoped is set, only grants whose permission
+// is listed in Scopes are considered, whatever the role allows. Impersonated
+// subjects never get admin grants.
+type Subject struct {
+	UserID int
+	Role   string
+	Scoped bool
+	Scopes []string
+
+	Impersonated bool
+}
+
+func (s Subject) inScope(permission string) bool {
+	if s.Impersonated && auth.IsAdminPermission(permission) {
+		return false
+	}
+	if !s.Scoped {
+		return true
+	}
+	for _, scope := range s.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Facts is what the rules need to know about a resource. DriverID is zero
+// when no driver is assigned.
+type Facts struct {
+	OwnerID  int
+	DriverID int
+}
+
+// ResourceLoader fetches the ownership and assignment facts of a resource.
+// It returns ErrNotFound when the resource doesn't exist.
+type ResourceLoader interface {
+	LoadVehicle(ctx context.Context, id int) (Facts, error)
+	LoadDriver(ctx context.Context, userID int) (Facts, error)
+	LoadOwner(ctx context.Context, userID int) (Facts, error)
+}
+
+type PermissionChecker interface {
+	HasPermission(role, permission string) (bool, error)
+}
+
+// Relation describes how the subject must be related to the resource for a
+// grant to apply.
+type Relation func(subject Subject, facts Facts) bool
+
+func Anyone(Subject, Facts) bool { return true }
+
+func IsOwner(subject Subject, facts Facts) bool {
+	return facts.OwnerID != 0 && facts.OwnerID == subject.UserID
+}
+
+func IsAssignedDriver(subject Subject, facts Facts) bool {
+	return facts.DriverID != 0 && facts.DriverID == subject.UserID
+}
+
+type Grant struct {
+	Permission string
+	Relation   Relation
+}
+
+// Rules lists, per action, the permissions that allow it and on which
+// resources. Drivers and owners are their own resource, so IsOwner and
+// IsAssignedDriver also mean "self" for them.
+var Rules = map[Action][]Grant{
+	ReadVehicle: {
+		{"admin:read.vehicle", Anyone},
+		{"owner:read.vehicle", IsOwner},
+		{"driver:update.vehicle", IsAssignedDriver},
+	},
+	UpdateVehicle: {
+		{"admin:update.vehicle", Anyone},
+		{"owner:update.vehicle", IsOwner},
+		{"driver:update.vehicle", IsAssignedDriver},
+	},
+	DeleteVehicle: {
+		{"admin:delete.vehicle", Anyone},
+		{"owner:delete.vehicle", IsOwner},
+	},
+	AssignDriver: {
+		{"admin:assign.driver", Anyone},
+	},
+	// Who drove the vehicle before is none of its current driver's business
+	ReadAssignments: {
+		{"admin:read.vehicle", Anyone},
+		{"owner:read.vehicle", IsOwner},
+	},
+
+	ReadDriver: {
+		{"admin:read.driver", Anyone},
+		{"driver:update.driver", IsAssignedDriver},
+	},
+	UpdateDriver: {
+		{"admin:update.driver", Anyone},
+		{"driver:update.driver", IsAssignedDriver},
+	},
+	DeleteDriver: {
+		{"admin:delete.driver", Anyone},
+		{"driver:delete.driver", IsAssignedDriver},
+	},
+
+	CreateVehicle: {
+		{"owner:create.vehicle", IsOwner},
+	},
+	ReadOwner: {
+		{"admin:read.owner", Anyone},
+		{"owner:read.vehicle", IsOwner},
+	},
+	UpdateOwner: {
+		{"admin:update.owner", Anyone},
+	},
+	DeleteOwner: {
+		{"admin:delete.owner", Anyone},
+		{"owner:delete.owner", IsOwner},
+	},
+}
+
+type Engine struct {
+	loader      ResourceLoader
+	permissions PermissionChecker
+	rules       map[Action][]Grant
+}
+
+func New(loader ResourceLoader, permissions PermissionChecker) *Engine {
+	return &Engine{loader: loader, permissions: permissions, rules: Rules}
+}
+
+// Authorize returns nil when subject may perform action on resource,
+// ErrForbidden when it may not and ErrNotFound when the resource doesn't
+// exist.
+func (e *Engine) Authorize(ctx context.Context, subject Subject, action Action, resource Resource) error {
+	grants, ok := e.rules[action]
+	if !ok {
+		return fmt.Errorf("no policy defined for action %s", action)
+	}
+
+	var relations []Relation
+	for _, grant := range grants {
+		if !subject.inScope(grant.Permission) {
+			continue
+		}
+		has, err := e.permissions.HasPermission(subject.Role, grant.Permission)
+		if err != nil {
+			return err
+		}
+		if has {
+			relations = append(relations, grant.Relation)
+		}
+	}
+	if len(relations) == 0 {
+		return ErrForbidden
+	}
+
+	facts, err := e.load(ctx, resource)
+	if err != nil {
+		return err
+	}
+	for _, relation := range relations {
+		if relation(subject, facts) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+func (e *Engine) load(ctx context.Context, resource Resource) (Facts, error) {
+	switch resource.Kind {
+	case KindVehicle:
+		return e.loader.LoadVehicle(ctx, resource.ID)
+	case KindDriver:
+		return e.loader.LoadDriver(ctx, resource.ID)
+	case KindOwner:
+		return e.loader.LoadOwner(ctx, resource.ID)
+	default:
+		return Facts{}, fmt.Errorf("unknown resource kind %s", resource.Kind)
+	}
+}
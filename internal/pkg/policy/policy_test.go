@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeLoader struct {
+	facts map[Resource]Facts
+	loads int
+}
+
+func (l *fakeLoader) load(resource Resource) (Facts, error) {
+	l.loads++
+	facts, ok := l.facts[resource]
+	if !ok {
+		return Facts{}, ErrNotFound
+	}
+	return facts, nil
+}
+
+func (l *fakeLoader) LoadVehicle(ctx context.Context, id int) (Facts, error) {
+	return l.load(Vehicle(id))
+}
+
+func (l *fakeLoader) LoadDriver(ctx context.Context, userID int) (Facts, error) {
+	return l.load(Driver(userID))
+}
+
+func (l *fakeLoader) LoadOwner(ctx context.Context, userID int) (Facts, error) {
+	return l.load(Owner(userID))
+}
+
+// fakePermissions maps roles to the permissions they hold.
+type fakePermissions map[string][]string
+
+func (p fakePermissions) HasPermission(role, permission string) (bool, error) {
+	for _, granted := range p[role] {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type failingPermissions struct{}
+
+func (failingPermissions) HasPermission(role, permission string) (bool, error) {
+	return false, errors.New("database is down")
+}
+
+const (
+	ownerID       = 1
+	otherOwnerID  = 2
+	driverID      = 3
+	otherDriverID = 4
+	adminID       = 5
+
+	assignedVehicle   = 10
+	unassignedVehicle = 11
+	ownerlessVehicle  = 12
+	missingVehicle    = 99
+)
+
+func newTestEngine() (*Engine, *fakeLoader) {
+	loader := &fakeLoader{facts: map[Resource]Facts{
+		Vehicle(assignedVehicle):   {OwnerID: ownerID, DriverID: driverID},
+		Vehicle(unassignedVehicle): {OwnerID: otherOwnerID},
+		Vehicle(ownerlessVehicle):  {},
+		Driver(driverID):           {DriverID: driverID},
+		Driver(otherDriverID):      {DriverID: otherDriverID},
+		Owner(ownerID):             {OwnerID: ownerID},
+		Owner(otherOwnerID):        {OwnerID: otherOwnerID},
+	}}
+	permissions := fakePermissions{
+		"super_admin": {
+			"admin:read.vehicle",
+			"admin:update.vehicle",
+			"admin:delete.vehicle",
+			"admin:read.driver",
+		},
+		"vehicle_owner": {
+			"owner:create.vehicle",
+			"owner:read.vehicle",
+			"owner:update.vehicle",
+			"owner:delete.vehicle",
+		},
+		"driver": {"driver:update.vehicle", "driver:update.driver"},
+	}
+	return New(loader, permissions), loader
+}
+
+func TestEngineAuthorize(t *testing.T) {
+	owner := Subject{UserID: ownerID, Role: "vehicle_owner"}
+	driver := Subject{UserID: driverID, Role: "driver"}
+	admin := Subject{UserID: adminID, Role: "super_admin"}
+	// A user ID of zero must not match resources that have no owner or driver
+	nobody := Subject{Role: "vehicle_owner"}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource Resource
+		want     error
+	}{
+		{"admin reads any vehicle", admin, ReadVehicle, Vehicle(unassignedVehicle), nil},
+		{"admin deletes any vehicle", admin, DeleteVehicle, Vehicle(assignedVehicle), nil},
+		{"admin reads any driver", admin, ReadDriver, Driver(otherDriverID), nil},
+		{"admin without the permission", admin, AssignDriver, Vehicle(assignedVehicle), ErrForbidden},
+
+		{"owner reads own vehicle", owner, ReadVehicle, Vehicle(assignedVehicle), nil},
+		{"owner updates own vehicle", owner, UpdateVehicle, Vehicle(assignedVehicle), nil},
+		{"owner reads other's vehicle", owner, ReadVehicle, Vehicle(unassignedVehicle), ErrForbidden},
+		{"owner deletes other's vehicle", owner, DeleteVehicle, Vehicle(unassignedVehicle), ErrForbidden},
+		{"owner adds to own fleet", owner, CreateVehicle, Owner(ownerID), nil},
+		{"owner adds to other's fleet", owner, CreateVehicle, Owner(otherOwnerID), ErrForbidden},
+		{"ownerless vehicle", nobody, ReadVehicle, Vehicle(ownerlessVehicle), ErrForbidden},
+
+		{"driver reads assigned vehicle", driver, ReadVehicle, Vehicle(assignedVehicle), nil},
+		{"driver updates assigned vehicle", driver, UpdateVehicle, Vehicle(assignedVehicle), nil},
+		{"driver reads other vehicle", driver, ReadVehicle, Vehicle(unassignedVehicle), ErrForbidden},
+		{"driver deletes assigned vehicle", driver, DeleteVehicle, Vehicle(assignedVehicle), ErrForbidden},
+		{"driver reads assignment history", driver, ReadAssignments, Vehicle(assignedVehicle), ErrForbidden},
+		{"driver reads self", driver, ReadDriver, Driver(driverID), nil},
+		{"driver reads other driver", driver, ReadDriver, Driver(otherDriverID), ErrForbidden},
+
+		{"missing vehicle", owner, ReadVehicle, Vehicle(missingVehicle), ErrNotFound},
+		{"missing vehicle without permission", driver, DeleteVehicle, Vehicle(missingVehicle), ErrForbidden},
+		{"missing driver", admin, ReadDriver, Driver(missingVehicle), ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, _ := newTestEngine()
+			err := engine.Authorize(context.Background(), tt.subject, tt.action, tt.resource)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineAuthorizeScoped(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource Resource
+		want     error
+	}{
+		{
+			"scope allows the grant",
+			Subject{UserID: ownerID, Role: "vehicle_owner", Scoped: true, Scopes: []string{"owner:read.vehicle"}},
+			ReadVehicle, Vehicle(assignedVehicle), nil,
+		},
+		{
+			"scope without the grant",
+			Subject{UserID: ownerID, Role: "vehicle_owner", Scoped: true, Scopes: []string{"owner:read.vehicle"}},
+			UpdateVehicle, Vehicle(assignedVehicle), ErrForbidden,
+		},
+		{
+			"no scopes",
+			Subject{UserID: ownerID, Role: "vehicle_owner", Scoped: true},
+			ReadVehicle, Vehicle(assignedVehicle), ErrForbidden,
+		},
+		{
+			"scope the role doesn't hold",
+			Subject{UserID: ownerID, Role: "vehicle_owner", Scoped: true, Scopes: []string{"admin:read.vehicle"}},
+			ReadVehicle, Vehicle(unassignedVehicle), ErrForbidden,
+		},
+		{
+			"admin scope still needs the admin grant",
+			Subject{UserID: adminID, Role: "super_admin", Scoped: true, Scopes: []string{"admin:read.vehicle"}},
+			DeleteVehicle, Vehicle(assignedVehicle), ErrForbidden,
+		},
+		{
+			"scoped to a missing resource",
+			Subject{UserID: adminID, Role: "super_admin", Scoped: true, Scopes: []string{"admin:read.vehicle"}},
+			ReadVehicle, Vehicle(missingVehicle), ErrNotFound,
+		},
+		{
+			"impersonated admin",
+			Subject{UserID: adminID, Role: "super_admin", Impersonated: true},
+			ReadVehicle, Vehicle(assignedVehicle), ErrForbidden,
+		},
+		{
+			"impersonated owner",
+			Subject{UserID: ownerID, Role: "vehicle_owner", Impersonated: true},
+			ReadVehicle, Vehicle(assignedVehicle), nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, _ := newTestEngine()
+			err := engine.Authorize(context.Background(), tt.subject, tt.action, tt.resource)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Without a matching permission the resource isn't loaded, so a forbidden
+// caller can't tell whether it exists.
+func TestEngineAuthorizeForbiddenWithoutLoading(t *testing.T) {
+	engine, loader := newTestEngine()
+	driver := Subject{UserID: driverID, Role: "driver"}
+	err := engine.Authorize(context.Background(), driver, DeleteVehicle, Vehicle(assignedVehicle))
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("got %v, want %v", err, ErrForbidden)
+	}
+	if loader.loads != 0 {
+		t.Errorf("loaded the resource %d times, want 0", loader.loads)
+	}
+}
+
+func TestEngineAuthorizeErrors(t *testing.T) {
+	owner := Subject{UserID: ownerID, Role: "vehicle_owner"}
+
+	engine, _ := newTestEngine()
+	err := engine.Authorize(context.Background(), owner, Action("vehicle:paint"), Vehicle(assignedVehicle))
+	if err == nil || errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown action: got %v, want an internal error", err)
+	}
+
+	err = engine.Authorize(context.Background(), owner, ReadVehicle, Resource{Kind: "trailer", ID: 1})
+	if err == nil || errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown resource kind: got %v, want an internal error", err)
+	}
+
+	failing := New(&fakeLoader{}, failingPermissions{})
+	err = failing.Authorize(context.Background(), owner, ReadVehicle, Vehicle(assignedVehicle))
+	if err == nil || errors.Is(err, ErrForbidden) {
+		t.Errorf("failing permission check: got %v, want its error", err)
+	}
+}
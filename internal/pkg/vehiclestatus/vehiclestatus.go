@@ -0,0 +1,146 @@
+// Package vehiclestatus is the lifecycle of a vehicle: the statuses allowed by
+// the vehicles.status CHECK constraint and which moves between them are legal,
+// under which conditions and for whom.
+package vehiclestatus
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Status string
+
+const (
+	Available    Status = "available"
+	InUse        Status = "in_use"
+	Maintenance  Status = "maintenance"
+	OutOfService Status = "out_of_service"
+)
+
+func (s Status) Valid() bool {
+	switch s {
+	case Available, InUse, Maintenance, OutOfService:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrUnknownStatus     = errors.New("unknown vehicle status")
+	ErrInvalidTransition = errors.New("transition not allowed")
+	ErrForbidden         = errors.New("not permitted to make this transition")
+)
+
+// GuardError explains why an otherwise legal transition can't happen yet.
+type GuardError struct {
+	Reason string
+}
+
+func (e *GuardError) Error() string {
+	return e.Reason
+}
+
+// Vehicle is what guards need to know about the vehicle being moved.
+type Vehicle struct {
+	Status    Status
+	HasDriver bool
+}
+
+// Guard returns a *GuardError when the vehicle isn't in a state that allows
+// the transition.
+type Guard func(v Vehicle) error
+
+// Transition is one legal move. Any of Permissions allows it; the handler is
+// expected to have checked the caller's relation to the vehicle already.
+type Transition struct {
+	From        Status
+	To          Status
+	Permissions []string
+	Guards      []Guard
+}
+
+func requireDriver(v Vehicle) error {
+	if !v.HasDriver {
+		return &GuardError{"a driver must be assigned to put the vehicle in use"}
+	}
+	return nil
+}
+
+func requireNoDriver(v Vehicle) error {
+	if v.HasDriver {
+		return &GuardError{"unassign the driver first"}
+	}
+	return nil
+}
+
+var (
+	assigners = []string{"admin:assign.driver"}
+	managers  = []string{"admin:update.vehicle", "owner:update.vehicle"}
+)
+
+// Transitions lists every legal move. Putting a vehicle in use and taking it
+// back out happen through driver assignment.
+var Transitions = []Transition{
+	{Available, InUse, assigners, []Guard{requireDriver}},
+	{InUse, Available, assigners, []Guard{requireNoDriver}},
+
+	{Available, Maintenance, managers, []Guard{requireNoDriver}},
+	{InUse, Maintenance, managers, []Guard{requireNoDriver}},
+	{Maintenance, Available, managers, nil},
+
+	{Available, OutOfService, managers, []Guard{requireNoDriver}},
+	{Maintenance, OutOfService, managers, nil},
+	{OutOfService, Maintenance, managers, nil},
+	{OutOfService, Available, managers, nil},
+}
+
+type Machine struct {
+	transitions map[Status]map[Status]Transition
+}
+
+func NewMachine(transitions []Transition) *Machine {
+	m := &Machine{transitions: make(map[Status]map[Status]Transition)}
+	for _, t := range transitions {
+		if m.transitions[t.From] == nil {
+			m.transitions[t.From] = make(map[Status]Transition)
+		}
+		m.transitions[t.From][t.To] = t
+	}
+	return m
+}
+
+var Default = NewMachine(Transitions)
+
+// Check returns nil when the vehicle may move to status to. hasPermission
+// answers whether the caller holds a permission.
+func (m *Machine) Check(v Vehicle, to Status, hasPermission func(string) (bool, error)) error {
+	if !to.Valid() {
+		return fmt.Errorf("%w %q", ErrUnknownStatus, to)
+	}
+	t, ok := m.transitions[v.Status][to]
+	if !ok {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, v.Status, to)
+	}
+
+	allowed := false
+	for _, permission := range t.Permissions {
+		has, err := hasPermission(permission)
+		if err != nil {
+			return err
+		}
+		if has {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+
+	for _, guard := range t.Guards {
+		if err := guard(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package vehiclestatus
+
+import (
+	"errors"
+	"testing"
+)
+
+// holding returns a permission check that answers yes for permissions.
+func holding(permissions ...string) func(string) (bool, error) {
+	return func(permission string) (bool, error) {
+		for _, held := range permissions {
+			if held == permission {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+var everything = holding("admin:assign.driver", "admin:update.vehicle", "owner:update.vehicle")
+
+var errGuard = &GuardError{}
+
+// checkError compares err with want, matching any *GuardError for errGuard.
+func checkError(t *testing.T, err, want error) {
+	t.Helper()
+	if want == errGuard {
+		var guardError *GuardError
+		if !errors.As(err, &guardError) {
+			t.Errorf("got %v, want a guard error", err)
+		}
+		return
+	}
+	if !errors.Is(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestCheckTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      Status
+		to        Status
+		hasDriver bool
+		want      error
+	}{
+		{"assign", Available, InUse, true, nil},
+		{"in use without a driver", Available, InUse, false, errGuard},
+		{"unassign", InUse, Available, false, nil},
+		{"available with a driver", InUse, Available, true, errGuard},
+
+		{"available to maintenance", Available, Maintenance, false, nil},
+		{"available to maintenance with a driver", Available, Maintenance, true, errGuard},
+		{"in use to maintenance", InUse, Maintenance, false, nil},
+		{"in use to maintenance with a driver", InUse, Maintenance, true, errGuard},
+		{"maintenance to available", Maintenance, Available, false, nil},
+
+		{"available to out of service", Available, OutOfService, false, nil},
+		{"available to out of service with a driver", Available, OutOfService, true, errGuard},
+		{"maintenance to out of service", Maintenance, OutOfService, false, nil},
+		{"out of service to maintenance", OutOfService, Maintenance, false, nil},
+		{"out of service to available", OutOfService, Available, false, nil},
+
+		{"in use to out of service", InUse, OutOfService, false, ErrInvalidTransition},
+		{"maintenance to in use", Maintenance, InUse, false, ErrInvalidTransition},
+		{"out of service to in use", OutOfService, InUse, false, ErrInvalidTransition},
+		{"same status", Maintenance, Maintenance, false, ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default.Check(Vehicle{Status: tt.from, HasDriver: tt.hasDriver}, tt.to, everything)
+			checkError(t, err, tt.want)
+		})
+	}
+}
+
+// Every pair of statuses is either in Transitions or rejected as invalid.
+func TestCheckOnlyListedTransitions(t *testing.T) {
+	legal := make(map[[2]Status]bool)
+	for _, transition := range Transitions {
+		legal[[2]Status{transition.From, transition.To}] = true
+	}
+
+	statuses := []Status{Available, InUse, Maintenance, OutOfService}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if legal[[2]Status{from, to}] {
+				continue
+			}
+			for _, hasDriver := range []bool{false, true} {
+				err := Default.Check(Vehicle{Status: from, HasDriver: hasDriver}, to, everything)
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Errorf("%s to %s: got %v, want %v", from, to, err, ErrInvalidTransition)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name          string
+		from          Status
+		to            Status
+		hasDriver     bool
+		hasPermission func(string) (bool, error)
+		want          error
+	}{
+		{"assigner puts in use", Available, InUse, true, holding("admin:assign.driver"), nil},
+		{"owner puts in use", Available, InUse, true, holding("owner:update.vehicle"), ErrForbidden},
+		{"admin sends to maintenance", Available, Maintenance, false, holding("admin:update.vehicle"), nil},
+		{"owner sends to maintenance", Available, Maintenance, false, holding("owner:update.vehicle"), nil},
+		{"assigner sends to maintenance", Available, Maintenance, false, holding("admin:assign.driver"), ErrForbidden},
+		{"driver sends to maintenance", Available, Maintenance, false, holding("driver:update.vehicle"), ErrForbidden},
+		{"no permissions", OutOfService, Available, false, holding(), ErrForbidden},
+		// Permissions are checked before the guards
+		{"forbidden and guarded", InUse, Maintenance, true, holding(), ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default.Check(Vehicle{Status: tt.from, HasDriver: tt.hasDriver}, tt.to, tt.hasPermission)
+			checkError(t, err, tt.want)
+		})
+	}
+}
+
+func TestCheckPermissionError(t *testing.T) {
+	failure := errors.New("database is down")
+	failing := func(string) (bool, error) { return false, failure }
+
+	err := Default.Check(Vehicle{Status: Available}, Maintenance, failing)
+	if !errors.Is(err, failure) {
+		t.Errorf("got %v, want %v", err, failure)
+	}
+}
+
+func TestCheckUnknownStatus(t *testing.T) {
+	for _, to := range []Status{"", "parked", "AVAILABLE"} {
+		err := Default.Check(Vehicle{Status: Available}, to, everything)
+		if !errors.Is(err, ErrUnknownStatus) {
+			t.Errorf("%q: got %v, want %v", to, err, ErrUnknownStatus)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A session groups every refresh token issued from one login (the token family).
+CREATE TABLE sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON sessions (user_id);
+
+-- Refresh tokens are only stored as SHA-256 hashes and can be used once.
+CREATE TABLE refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	session_id VARCHAR(64) NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON refresh_tokens (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Individually revoked access tokens, kept until the token would have expired anyway.
+CREATE TABLE revoked_tokens (
+	jti VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ON revoked_tokens (expires_at);
+
+-- Every token of the user issued at or before revoked_before is rejected.
+CREATE TABLE user_token_revocations (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	revoked_before TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO permissions (name)
+VALUES ('admin:revoke.token') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:revoke.token';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:revoke.token');
+
+DELETE FROM permissions
+WHERE name = 'admin:revoke.token';
+
+DROP TABLE IF EXISTS user_token_revocations;
+DROP TABLE IF EXISTS revoked_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Permissions are resolved from these tables at request time and cached per role
+-- by the API. These triggers tell every instance which role's cache to drop; '*'
+-- means the change may affect any role.
+CREATE OR REPLACE FUNCTION notify_role_permissions_changed() RETURNS trigger AS $$
+DECLARE
+	changed_role_id INTEGER;
+	changed_role_name VARCHAR(50);
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		changed_role_id := OLD.role_id;
+	ELSE
+		changed_role_id := NEW.role_id;
+	END IF;
+
+	SELECT name INTO changed_role_name FROM roles WHERE id = changed_role_id;
+	PERFORM pg_notify('role_permissions_changed', COALESCE(changed_role_name, '*'));
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_all_role_permissions_changed() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('role_permissions_changed', '*');
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER role_permissions_changed
+AFTER INSERT OR UPDATE OR DELETE ON role_permissions
+FOR EACH ROW EXECUTE FUNCTION notify_role_permissions_changed();
+
+CREATE TRIGGER permissions_changed
+AFTER UPDATE OR DELETE ON permissions
+FOR EACH STATEMENT EXECUTE FUNCTION notify_all_role_permissions_changed();
+
+CREATE TRIGGER roles_changed
+AFTER UPDATE OR DELETE ON roles
+FOR EACH STATEMENT EXECUTE FUNCTION notify_all_role_permissions_changed();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS roles_changed ON roles;
+DROP TRIGGER IF EXISTS permissions_changed ON permissions;
+DROP TRIGGER IF EXISTS role_permissions_changed ON role_permissions;
+DROP FUNCTION IF EXISTS notify_all_role_permissions_changed();
+DROP FUNCTION IF EXISTS notify_role_permissions_changed();
+-- +goose StatementEnd
@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Roles are now managed through the API. The FK on users.role already restricts
+-- users to existing roles, so the hardcoded list is no longer needed.
+ALTER TABLE users
+DROP CONSTRAINT check_user_role;
+
+-- System roles and permissions are referenced by the application and can't be deleted.
+-- Self-registration decides which roles may be picked on /register.
+ALTER TABLE roles
+ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN self_registration BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE permissions
+ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE roles SET is_system = TRUE;
+UPDATE roles SET self_registration = TRUE WHERE name IN ('driver', 'vehicle_owner');
+
+INSERT INTO permissions (name) VALUES
+('admin:manage.roles'),
+('admin:assign.role')
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE permissions SET is_system = TRUE;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name IN (
+		'admin:manage.roles',
+		'admin:assign.role'
+	);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id IN (
+	SELECT id FROM permissions WHERE name IN (
+		'admin:manage.roles',
+		'admin:assign.role'
+	)
+);
+
+DELETE FROM permissions
+WHERE name IN (
+	'admin:manage.roles',
+	'admin:assign.role'
+);
+
+ALTER TABLE permissions
+DROP COLUMN is_system;
+
+ALTER TABLE roles
+DROP COLUMN self_registration,
+DROP COLUMN is_system;
+
+ALTER TABLE users
+ADD CONSTRAINT check_user_role CHECK (role IN ('driver', 'vehicle_owner', 'super_admin'));
+-- +goose StatementEnd
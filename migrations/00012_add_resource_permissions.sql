@@ -0,0 +1,67 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Permissions checked by the ownership policy layer. Admin permissions apply to
+-- any resource, the others only to resources the user owns or is assigned to.
+INSERT INTO permissions (name, is_system) VALUES
+('owner:update.vehicle', TRUE),
+('admin:update.vehicle', TRUE),
+('admin:delete.vehicle', TRUE),
+('admin:update.driver', TRUE),
+('admin:delete.driver', TRUE),
+('admin:update.owner', TRUE),
+('admin:delete.owner', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'vehicle_owner' AND p.name = 'owner:update.vehicle';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name IN (
+		'admin:read.vehicle',
+		'admin:update.vehicle',
+		'admin:delete.vehicle',
+		'admin:update.driver',
+		'admin:delete.driver',
+		'admin:update.owner',
+		'admin:delete.owner'
+	)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id IN (
+	SELECT id FROM permissions WHERE name IN (
+		'owner:update.vehicle',
+		'admin:update.vehicle',
+		'admin:delete.vehicle',
+		'admin:update.driver',
+		'admin:delete.driver',
+		'admin:update.owner',
+		'admin:delete.owner'
+	)
+);
+
+DELETE FROM permissions
+WHERE name IN (
+	'owner:update.vehicle',
+	'admin:update.vehicle',
+	'admin:delete.vehicle',
+	'admin:update.driver',
+	'admin:delete.driver',
+	'admin:update.owner',
+	'admin:delete.owner'
+);
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- TOTP secrets. enabled_at stays NULL until the user confirms enrollment with a
+-- valid code. last_used_step prevents a code from being replayed.
+CREATE TABLE user_mfa (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(64) NOT NULL,
+	enabled_at TIMESTAMPTZ,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	failed_attempts INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE mfa_recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash CHAR(64) NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON mfa_recovery_codes (user_id);
+
+ALTER TABLE roles
+ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Super admins hold every permission, so they enroll on their next login
+UPDATE roles SET mfa_required = TRUE WHERE name = 'super_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE roles
+DROP COLUMN mfa_required;
+
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Long-lived keys for machine integrations. They act as the owning user but
+-- only with the permissions listed in api_key_scopes. Only the SHA-256 hash of
+-- a key is stored; prefix is kept in clear so users can tell keys apart.
+CREATE TABLE api_keys (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) UNIQUE NOT NULL,
+	key_hash CHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON api_keys (user_id);
+
+CREATE TABLE api_key_scopes (
+	api_key_id INTEGER REFERENCES api_keys(id) ON DELETE CASCADE,
+	permission_id INTEGER REFERENCES permissions(id) ON DELETE CASCADE,
+	PRIMARY KEY (api_key_id, permission_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_key_scopes;
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
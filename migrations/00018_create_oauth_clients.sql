@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- OAuth2 clients for the client_credentials grant. A client acts as user_id,
+-- restricted to the permissions in oauth_client_scopes. Only the SHA-256 hash
+-- of the secret is stored.
+CREATE TABLE oauth_clients (
+	id SERIAL PRIMARY KEY,
+	client_id VARCHAR(64) UNIQUE NOT NULL,
+	secret_hash CHAR(64) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE oauth_client_scopes (
+	client_id INTEGER REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	permission_id INTEGER REFERENCES permissions(id) ON DELETE CASCADE,
+	PRIMARY KEY (client_id, permission_id)
+);
+
+INSERT INTO permissions (name, is_system)
+VALUES ('admin:manage.clients', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:manage.clients';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:manage.clients');
+
+DELETE FROM permissions
+WHERE name = 'admin:manage.clients';
+
+DROP TABLE IF EXISTS oauth_client_scopes;
+DROP TABLE IF EXISTS oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Lets users recognise their sessions and sign out the ones they don't
+-- recognise. Access tokens carry the session ID in their sid claim.
+ALTER TABLE sessions
+ADD COLUMN user_agent TEXT,
+ADD COLUMN ip_address TEXT,
+ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX ON sessions (revoked_at);
+
+INSERT INTO permissions (name, is_system)
+VALUES ('admin:manage.sessions', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:manage.sessions';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:manage.sessions');
+
+DELETE FROM permissions
+WHERE name = 'admin:manage.sessions';
+
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS last_seen_at,
+DROP COLUMN IF EXISTS ip_address,
+DROP COLUMN IF EXISTS user_agent;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleted accounts are anonymized rather than removed so that whatever
+-- references them keeps pointing at a row.
+ALTER TABLE users
+ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Deleting a driver sets vehicles.driver_id to NULL; a vehicle that was in
+-- use by that driver is available again.
+CREATE OR REPLACE FUNCTION release_vehicle_without_driver() RETURNS trigger AS $$
+BEGIN
+	IF NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL AND NEW.status = 'in_use' THEN
+		NEW.status := 'available';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER vehicles_release_without_driver
+BEFORE UPDATE OF driver_id ON vehicles
+FOR EACH ROW EXECUTE FUNCTION release_vehicle_without_driver();
+
+INSERT INTO permissions (name, is_system)
+VALUES ('owner:delete.owner', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'vehicle_owner' AND p.name = 'owner:delete.owner';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'owner:delete.owner');
+
+DELETE FROM permissions
+WHERE name = 'owner:delete.owner';
+
+DROP TRIGGER IF EXISTS vehicles_release_without_driver ON vehicles;
+DROP FUNCTION IF EXISTS release_vehicle_without_driver();
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE vehicle_status_transitions (
+	id SERIAL PRIMARY KEY,
+	vehicle_id INT NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+	from_status VARCHAR(20) NOT NULL,
+	to_status VARCHAR(20) NOT NULL,
+	-- NULL when the database made the change, e.g. releasing the vehicle of
+	-- a deleted driver
+	actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+	reason TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_vehicle_status_transitions_vehicle ON vehicle_status_transitions (vehicle_id, created_at);
+
+-- The release of a vehicle by a deleted driver is a transition too.
+CREATE OR REPLACE FUNCTION release_vehicle_without_driver() RETURNS trigger AS $$
+BEGIN
+	IF NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL AND NEW.status = 'in_use' THEN
+		NEW.status := 'available';
+		INSERT INTO vehicle_status_transitions (vehicle_id, from_status, to_status, reason)
+		VALUES (NEW.id, 'in_use', 'available', 'Driver removed');
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION release_vehicle_without_driver() RETURNS trigger AS $$
+BEGIN
+	IF NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL AND NEW.status = 'in_use' THEN
+		NEW.status := 'available';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS vehicle_status_transitions;
+-- +goose StatementEnd
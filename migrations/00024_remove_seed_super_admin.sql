@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- 00002 seeded a super_admin whose password hash is in the repository. Admins
+-- are created with `fleet admin create` or BOOTSTRAP_ADMIN_* now. The account
+-- is matched by email alone: logging in replaces the seeded bcrypt hash with
+-- an argon2id hash of the same, published password.
+DELETE FROM users
+WHERE email = 'kwagmire999@gmail.com';
+-- +goose StatementEnd
+
+-- +goose Down
+-- The seeded account isn't restored
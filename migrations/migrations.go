@@ -1,6 +1,13 @@
+// Package migrations embeds the SQL migrations of both databases: the
+// PostgreSQL ones next to this file and their SQLite counterparts in sqlite/.
 package migrations
 
 import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
 	"log"
 
 	"github.com/pressly/goose/v3"
@@ -8,15 +15,36 @@ import (
 	"github.com/kwagmire/fleet-management-api/internal/pkg/db"
 )
 
-func RunMigrations() {
-	db.ConnectDB()
-	// Specify the directory where your migration files are located
-	//goose.SetDir("./migrations")
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
 
-	// Run the migrations
-	if err := goose.Up(db.DB, "../../migrations"); err != nil {
-		log.Fatalf("goose: failed to run migrations: %v\n", err)
+// NewProvider returns a goose provider for the migrations of conn's dialect.
+func NewProvider(conn *sql.DB) (*goose.Provider, error) {
+	dialect := goose.DialectPostgres
+	var fsys fs.FS = files
+	if db.Current == db.SQLite {
+		dialect = goose.DialectSQLite3
+		sub, err := fs.Sub(files, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
 	}
+	return goose.NewProvider(dialect, conn, fsys)
+}
 
-	log.Println("Database migrations applied successfully.")
+// Up applies every pending migration to conn.
+func Up(ctx context.Context, conn *sql.DB) error {
+	provider, err := NewProvider(conn)
+	if err != nil {
+		return err
+	}
+	results, err := provider.Up(ctx)
+	for _, result := range results {
+		log.Println(result)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+	return nil
 }
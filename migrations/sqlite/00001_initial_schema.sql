@@ -0,0 +1,85 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SQLite version of the initial schema. SQLite can't add or drop table
+-- constraints later, so vehicles is created the way 00005 leaves it on
+-- Postgres: without the one-vehicle-per-owner constraint and with
+-- check_vehicle_year. SQLite doesn't enforce VARCHAR lengths either; the
+-- *_length checks do it instead.
+
+CREATE TABLE roles (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(50) UNIQUE NOT NULL
+);
+
+CREATE TABLE permissions (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(100) UNIQUE NOT NULL
+);
+
+CREATE TABLE role_permissions (
+	role_id INTEGER REFERENCES roles(id) ON DELETE CASCADE,
+	permission_id INTEGER REFERENCES permissions(id) ON DELETE CASCADE,
+	PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	fullname VARCHAR(100) NOT NULL CONSTRAINT users_fullname_length CHECK (length(fullname) <= 100),
+	password_hash VARCHAR(255) NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL CONSTRAINT users_email_length CHECK (length(email) <= 100),
+	role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE RESTRICT
+);
+
+CREATE INDEX users_role_idx ON users (role);
+
+CREATE TABLE drivers (
+	user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+	license_id VARCHAR(50) UNIQUE NOT NULL CONSTRAINT drivers_license_id_length CHECK (length(license_id) <= 50),
+	assigned BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE vehicle_owners (
+	user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+	fleet_size INTEGER NOT NULL CHECK (fleet_size >= 0)
+);
+
+CREATE TABLE vehicles (
+	id INTEGER PRIMARY KEY,
+	make VARCHAR(50) NOT NULL CONSTRAINT vehicles_make_length CHECK (length(make) <= 50),
+	model VARCHAR(50) NOT NULL CONSTRAINT vehicles_model_length CHECK (length(model) <= 50),
+	year INTEGER NOT NULL CONSTRAINT check_vehicle_year CHECK (year >= 2005),
+	license_plate VARCHAR(20) UNIQUE NOT NULL CONSTRAINT vehicles_license_plate_length CHECK (length(license_plate) <= 20),
+	status VARCHAR(20) NOT NULL CHECK (status IN ('available', 'in_use', 'maintenance', 'out_of_service')),
+	driver_id INTEGER UNIQUE REFERENCES drivers(user_id) ON DELETE SET NULL,
+	owner_id INTEGER REFERENCES vehicle_owners(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX vehicles_owner_id_idx ON vehicles (owner_id);
+CREATE INDEX vehicles_status_idx ON vehicles (status);
+
+INSERT INTO roles (name) VALUES
+('super_admin'),
+('vehicle_owner'),
+('driver');
+
+INSERT INTO permissions (name) VALUES
+('vehicle.create'),
+('vehicle.read'),
+('vehicle.update'),
+('vehicle.delete'),
+('driver.create'),
+('driver.read'),
+('driver.update'),
+('driver.delete');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS vehicles;
+DROP TABLE IF EXISTS vehicle_owners;
+DROP TABLE IF EXISTS drivers;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
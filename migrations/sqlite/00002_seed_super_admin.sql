@@ -0,0 +1,6 @@
+-- +goose Up
+-- The PostgreSQL migrations seeded a super_admin here, until 00024 removed it.
+-- SQLite databases get their first admin from `fleet admin create` or
+-- BOOTSTRAP_ADMIN_* instead.
+
+-- +goose Down
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A session groups every refresh token issued from one login (the token family).
+CREATE TABLE sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- Refresh tokens are only stored as SHA-256 hashes and can be used once.
+CREATE TABLE refresh_tokens (
+	id INTEGER PRIMARY KEY,
+	session_id VARCHAR(64) NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Postgres notifies every API instance of role permission changes. A SQLite
+-- database is only served by one instance, which drops its own cache when it
+-- changes a role, so there is nothing to do here.
+
+-- +goose Down
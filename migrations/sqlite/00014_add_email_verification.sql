@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts created before verification existed are trusted as they are
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
+INSERT INTO permissions (name, is_system)
+VALUES ('admin:verify.user', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:verify.user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:verify.user');
+
+DELETE FROM permissions
+WHERE name = 'admin:verify.user';
+
+DELETE FROM user_tokens WHERE purpose = 'email_verification';
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Failed login counters. key is 'account:<email>' or 'ip:<address>'.
+CREATE TABLE login_throttles (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked_until TIMESTAMP
+);
+
+-- Security relevant authentication events such as failed logins and lockouts.
+CREATE TABLE auth_events (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	event_type VARCHAR(50) NOT NULL,
+	email TEXT,
+	ip_address VARCHAR(64),
+	details TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX auth_events_user_id_idx ON auth_events (user_id);
+CREATE INDEX auth_events_created_at_idx ON auth_events (created_at);
+
+INSERT INTO permissions (name, is_system)
+VALUES ('admin:unlock.user', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:unlock.user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:unlock.user');
+
+DELETE FROM permissions
+WHERE name = 'admin:unlock.user';
+
+DROP TABLE IF EXISTS auth_events;
+DROP TABLE IF EXISTS login_throttles;
+-- +goose StatementEnd
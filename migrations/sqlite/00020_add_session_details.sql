@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Lets users recognise their sessions and sign out the ones they don't
+-- recognise. Access tokens carry the session ID in their sid claim.
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;
+-- SQLite can't add a column defaulting to CURRENT_TIMESTAMP, so the trigger
+-- below fills it in instead
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP;
+
+UPDATE sessions SET last_seen_at = created_at;
+
+CREATE TRIGGER sessions_default_last_seen_at
+AFTER INSERT ON sessions
+FOR EACH ROW WHEN NEW.last_seen_at IS NULL
+BEGIN
+	UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE INDEX sessions_revoked_at_idx ON sessions (revoked_at);
+
+INSERT INTO permissions (name, is_system)
+VALUES ('admin:manage.sessions', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'super_admin' AND p.name = 'admin:manage.sessions';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'admin:manage.sessions');
+
+DELETE FROM permissions
+WHERE name = 'admin:manage.sessions';
+
+DROP INDEX IF EXISTS sessions_revoked_at_idx;
+DROP TRIGGER IF EXISTS sessions_default_last_seen_at;
+
+ALTER TABLE sessions DROP COLUMN last_seen_at;
+ALTER TABLE sessions DROP COLUMN ip_address;
+ALTER TABLE sessions DROP COLUMN user_agent;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleted accounts are anonymized rather than removed so that whatever
+-- references them keeps pointing at a row.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+-- Deleting a driver sets vehicles.driver_id to NULL; a vehicle that was in
+-- use by that driver is available again.
+CREATE TRIGGER vehicles_release_without_driver
+AFTER UPDATE OF driver_id ON vehicles
+FOR EACH ROW WHEN NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL AND NEW.status = 'in_use'
+BEGIN
+	UPDATE vehicles SET status = 'available' WHERE id = NEW.id;
+END;
+
+INSERT INTO permissions (name, is_system)
+VALUES ('owner:delete.owner', TRUE) ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+	r.id, p.id
+FROM
+	roles r, permissions p
+WHERE
+	r.name = 'vehicle_owner' AND p.name = 'owner:delete.owner';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM role_permissions
+WHERE permission_id = (SELECT id FROM permissions WHERE name = 'owner:delete.owner');
+
+DELETE FROM permissions
+WHERE name = 'owner:delete.owner';
+
+DROP TRIGGER IF EXISTS vehicles_release_without_driver;
+
+ALTER TABLE users DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- One row per period a driver had a vehicle. The plate is copied so that the
+-- history still means something after the vehicle is deleted.
+CREATE TABLE vehicle_assignments (
+	id INTEGER PRIMARY KEY,
+	vehicle_id INT REFERENCES vehicles(id) ON DELETE SET NULL,
+	license_plate VARCHAR(20) NOT NULL,
+	driver_id INT NOT NULL REFERENCES users(id),
+	assigned_by INT REFERENCES users(id) ON DELETE SET NULL,
+	unassigned_by INT REFERENCES users(id) ON DELETE SET NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ended_at TIMESTAMP,
+	CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+CREATE INDEX idx_vehicle_assignments_vehicle ON vehicle_assignments (vehicle_id, started_at);
+CREATE INDEX idx_vehicle_assignments_driver ON vehicle_assignments (driver_id, started_at);
+CREATE UNIQUE INDEX idx_vehicle_assignments_open_vehicle ON vehicle_assignments (vehicle_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX idx_vehicle_assignments_open_driver ON vehicle_assignments (driver_id) WHERE ended_at IS NULL;
+
+-- When the current assignments started is unknown, so they start now.
+INSERT INTO vehicle_assignments (vehicle_id, license_plate, driver_id)
+SELECT id, license_plate, driver_id FROM vehicles WHERE driver_id IS NOT NULL;
+
+-- Drivers that were marked assigned without a vehicle can't be unassigned
+-- through the API.
+UPDATE drivers
+SET assigned = FALSE
+WHERE assigned AND user_id NOT IN (SELECT driver_id FROM vehicles WHERE driver_id IS NOT NULL);
+
+-- Deleting a driver also ends their assignment.
+DROP TRIGGER vehicles_release_without_driver;
+
+CREATE TRIGGER vehicles_release_without_driver
+AFTER UPDATE OF driver_id ON vehicles
+FOR EACH ROW WHEN NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL
+BEGIN
+	UPDATE vehicle_assignments SET ended_at = CURRENT_TIMESTAMP
+	WHERE vehicle_id = NEW.id AND ended_at IS NULL;
+
+	UPDATE vehicles SET status = 'available' WHERE id = NEW.id AND status = 'in_use';
+	INSERT INTO vehicle_status_transitions (vehicle_id, from_status, to_status, reason)
+	SELECT NEW.id, 'in_use', 'available', 'Driver removed' WHERE NEW.status = 'in_use';
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER vehicles_release_without_driver;
+
+CREATE TRIGGER vehicles_release_without_driver
+AFTER UPDATE OF driver_id ON vehicles
+FOR EACH ROW WHEN NEW.driver_id IS NULL AND OLD.driver_id IS NOT NULL AND NEW.status = 'in_use'
+BEGIN
+	UPDATE vehicles SET status = 'available' WHERE id = NEW.id;
+	INSERT INTO vehicle_status_transitions (vehicle_id, from_status, to_status, reason)
+	VALUES (NEW.id, 'in_use', 'available', 'Driver removed');
+END;
+
+DROP TABLE IF EXISTS vehicle_assignments;
+-- +goose StatementEnd
@@ -0,0 +1,5 @@
+-- +goose Up
+-- 00002 never seeded a super_admin into SQLite databases, so there is nothing
+-- to remove.
+
+-- +goose Down
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Failed second factor attempts are counted per account in login_throttles,
+-- under 'mfa:<user id>', instead of per login challenge.
+ALTER TABLE user_mfa
+DROP COLUMN failed_attempts;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_mfa
+ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+
+DELETE FROM login_throttles
+WHERE key LIKE 'mfa:%';
+-- +goose StatementEnd